@@ -2,14 +2,17 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
+	"github.com/egosha7/shortlink/internal/app"
+	"github.com/egosha7/shortlink/internal/auth"
 	"github.com/egosha7/shortlink/internal/config"
-	"github.com/egosha7/shortlink/internal/db"
 	"github.com/egosha7/shortlink/internal/loger"
-	routes "github.com/egosha7/shortlink/internal/router"
 	"go.uber.org/zap"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 )
 
 func main() {
@@ -22,22 +25,84 @@ func main() {
 	defer logger.Sync()
 
 	// Проверка конфигурации флагов и переменных окружения
-	cfg := config.OnFlag(logger)
+	cfg, err := config.OnFlag(logger)
+	if err != nil {
+		logger.Error("Error reading configuration", zap.Error(err))
+		os.Exit(1)
+	}
 
-	conn, err := db.ConnectToDB(cfg)
+	// Дальше пишем логи с уровнем и в формате из конфигурации
+	logger, err = loger.NewLogger(cfg.LogLevel, cfg.LogEncoding)
 	if err != nil {
-		logger.Error("Error connecting to database", zap.Error(err))
+		fmt.Fprintf(os.Stderr, "Error creating logger: %v\n", err)
 		os.Exit(1)
 	}
-	defer conn.Close(context.Background())
+	defer logger.Sync()
+
+	// Подкоманда управления миграциями БД
+	if flag.Arg(0) == "migrate" {
+		if err := runMigrate(cfg, flag.Args()[1:], logger); err != nil {
+			logger.Error("Error running migrations", zap.Error(err))
+			os.Exit(1)
+		}
+		return
+	}
 
-	r := routes.SetupRoutes(cfg, conn, logger)
+	// Ключи подписи токенов пользователей
+	keys, err := auth.KeySetFromConfig(cfg, logger)
+	if err != nil {
+		logger.Error("Error configuring auth keys", zap.Error(err))
+		os.Exit(1)
+	}
 
-	// Запуск сервера
-	err = http.ListenAndServe(cfg.Addr, loger.LogMiddleware(logger, r))
+	// Сборка хранилищ и фоновых задач, ошибка конфигурации останавливает запуск
+	application, err := app.New(context.Background(), cfg, keys, logger)
 	if err != nil {
+		logger.Error("Error initializing service", zap.Error(err))
+		os.Exit(1)
+	}
+
+	server := &http.Server{
+		Addr:    cfg.Addr,
+		Handler: loger.LogMiddleware(logger, application.Handler),
+	}
+
+	// Остановка по сигналу, например при деплое
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Запуск сервера
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err = <-serveErr:
 		logger.Error("Error starting server", zap.Error(err))
+
+		// Фоновые задачи уже запущены: сохраняем накопленные переходы и закрываем хранилище
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+		if err = application.Shutdown(shutdownCtx); err != nil {
+			logger.Error("Error stopping background tasks", zap.Error(err))
+		}
+		cancel()
 		os.Exit(1)
+	case <-ctx.Done():
+		stop()
+	}
+	logger.Info("Shutting down server", zap.Duration("timeout", cfg.ShutdownTimeout))
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	// Дожидаемся завершения открытых запросов, затем фоновых задач
+	if err = server.Shutdown(shutdownCtx); err != nil {
+		logger.Error("Error shutting down server", zap.Error(err))
+	}
+	if err = application.Shutdown(shutdownCtx); err != nil {
+		logger.Error("Error stopping background tasks", zap.Error(err))
 	}
 
+	logger.Info("Server stopped")
 }
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/egosha7/shortlink/internal/config"
+	"github.com/egosha7/shortlink/internal/db"
+	"github.com/egosha7/shortlink/internal/migrations"
+	"go.uber.org/zap"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// runMigrate - выполнение подкоманды migrate up|down|status
+func runMigrate(cfg *config.Config, args []string, logger *zap.Logger) error {
+	if len(args) != 1 {
+		return errors.New("usage: shortener [flags] migrate up|down|status")
+	}
+	if cfg.DataBase == "" {
+		return errors.New("database address is not set, use -d or DATABASE_DSN")
+	}
+
+	ctx := context.Background()
+	pool, err := db.Open(ctx, cfg.DataBase, 1)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	// Блокировка миграций держится на уровне сессии, поэтому все шаги идут через одно соединение
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	migrator, err := migrations.NewMigrator(conn.Conn(), logger)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		return migrator.Up(ctx)
+	case "down":
+		return migrator.Down(ctx)
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+		}
+		return w.Flush()
+	default:
+		return fmt.Errorf("unknown migrate command %q", args[0])
+	}
+}
@@ -0,0 +1,92 @@
+package analytics
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/egosha7/shortlink/internal/config"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"go.uber.org/zap"
+	"time"
+)
+
+// Click - переход по сокращенной ссылке
+type Click struct {
+	ShortID   string    `json:"short_id"`
+	Time      time.Time `json:"time"`
+	Referrer  string    `json:"referrer,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	IPHash    string    `json:"ip_hash,omitempty"` // HMAC адреса клиента, сам адрес не хранится
+}
+
+type DailyCount struct {
+	Date  string `json:"date"` // День в UTC в формате 2006-01-02
+	Count int    `json:"count"`
+}
+
+// Stats - статистика переходов по ссылке
+type Stats struct {
+	Total int          `json:"total"`
+	Daily []DailyCount `json:"daily"`
+}
+
+// Sink - интерфейс хранилища переходов
+type Sink interface {
+	SaveClicks(ctx context.Context, clicks []Click) error
+	Stats(ctx context.Context, shortID string) (Stats, error)
+	Close() error
+}
+
+// NewSink - функция для выбора хранилища переходов по конфигурации, аналогично storage.NewStorage
+func NewSink(cfg *config.Config, pool *pgxpool.Pool, logger *zap.Logger) (Sink, error) {
+	if cfg.DataBase != "" {
+		if pool == nil {
+			return nil, errors.New("postgres click storage requires a connection pool")
+		}
+		return NewPostgresSink(pool), nil
+	}
+
+	if cfg.FilePath != "" {
+		return NewFileSink(cfg.FilePath+".clicks", logger)
+	}
+
+	return NewMemorySink(), nil
+}
+
+// HashIP - функция для хеширования адреса клиента HMAC-SHA-256 с секретом сервера:
+// хеш без секрета обращается перебором всех адресов IPv4 за секунды
+func HashIP(key []byte, ip string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(ip))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// IPKeyFromConfig - функция для получения секрета хеширования адресов из конфигурации.
+// Без отдельного ключа он выводится из ключа подписи токенов, а без обоих генерируется случайно
+func IPKeyFromConfig(cfg *config.Config, logger *zap.Logger) ([]byte, error) {
+	if cfg.ClickIPKey != "" {
+		return []byte(cfg.ClickIPKey), nil
+	}
+
+	if cfg.SecretKey != "" {
+		// Ключ подписи не используется напрямую, чтобы хеши не зависели от его назначения
+		mac := hmac.New(sha256.New, []byte(cfg.SecretKey))
+		mac.Write([]byte("click ip"))
+		return mac.Sum(nil), nil
+	}
+
+	// Хеши одного адреса будут различаться до и после перезапуска
+	logger.Warn("Click IP key is not set, using a random key")
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func dayOf(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
@@ -0,0 +1,108 @@
+package analytics
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"go.uber.org/zap"
+	"os"
+)
+
+// FileSink дописывает переходы в JSONL-файл и держит счетчики в памяти
+type FileSink struct {
+	*MemorySink
+	file *os.File
+}
+
+// NewFileSink - функция для открытия файла переходов с восстановлением счетчиков из него
+func NewFileSink(filePath string, logger *zap.Logger) (*FileSink, error) {
+	s := &FileSink{MemorySink: NewMemorySink()}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	size := s.load(data, logger)
+
+	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	// Оборванную последнюю запись отбрасываем, иначе следующая пачка склеится с ней
+	// в одну нечитаемую строку. Целой записи без перевода строки он дописывается
+	if err = file.Truncate(size); err == nil && size > 0 && data[size-1] != '\n' {
+		_, err = file.Write([]byte{'\n'})
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	s.file = file
+
+	return s, nil
+}
+
+// load восстанавливает счетчики из содержимого файла и возвращает его размер без оборванной последней записи
+func (s *FileSink) load(data []byte, logger *zap.Logger) int64 {
+	var size int64
+	reader := bufio.NewReader(bytes.NewReader(data))
+	for {
+		line, err := reader.ReadBytes('\n')
+		last := err != nil
+
+		if len(bytes.TrimSpace(line)) > 0 {
+			var click Click
+			if err := json.Unmarshal(line, &click); err != nil {
+				if last {
+					// Последняя запись оборвана при аварийном завершении
+					logger.Warn("Skipping truncated click record", zap.Error(err))
+					break
+				}
+				// Поврежденная запись не должна мешать запуску
+				logger.Warn("Skipping invalid click record", zap.Error(err))
+			} else {
+				s.add([]Click{click})
+			}
+		}
+		size += int64(len(line))
+
+		if last {
+			break
+		}
+	}
+	return size
+}
+
+func (s *FileSink) SaveClicks(ctx context.Context, clicks []Click) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Пачка кодируется в буфер и записывается в файл одним вызовом Write
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, click := range clicks {
+		if err := enc.Encode(click); err != nil {
+			return err
+		}
+	}
+	if _, err := s.file.Write(buf.Bytes()); err != nil {
+		return err
+	}
+
+	s.add(clicks)
+	return nil
+}
+
+// Close закрывает файл переходов
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.file.Sync()
+	if closeErr := s.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,43 @@
+package analytics
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestFileSinkTruncatedTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "urls.json.clicks")
+	day := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	err := os.WriteFile(path, []byte(`{"short_id":"abc","time":"2023-10-01T12:00:00Z"}`+"\n"+`{"short_id":"abc","ti`), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Каждый перезапуск дописывает переход, все они должны пережить следующий
+	for i := 0; i < 2; i++ {
+		sink, err := NewFileSink(path, zap.NewNop())
+		if err != nil {
+			t.Fatalf("restart %d: %v", i+1, err)
+		}
+		if err = sink.SaveClicks(context.Background(), []Click{{ShortID: "abc", Time: day}}); err != nil {
+			t.Fatal(err)
+		}
+		sink.Close()
+	}
+
+	restored, err := NewFileSink(path, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+
+	if stats, _ := restored.Stats(context.Background(), "abc"); stats.Total != 3 {
+		t.Errorf("got %d clicks after restarts, want 3", stats.Total)
+	}
+}
@@ -0,0 +1,61 @@
+package analytics
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// MemorySink хранит в памяти только счетчики переходов по дням
+type MemorySink struct {
+	mu    sync.RWMutex
+	daily map[string]map[string]int // ID ссылки -> день -> количество
+}
+
+func NewMemorySink() *MemorySink {
+	return &MemorySink{
+		daily: make(map[string]map[string]int),
+	}
+}
+
+func (s *MemorySink) SaveClicks(ctx context.Context, clicks []Click) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.add(clicks)
+	return nil
+}
+
+// add учитывает переходы в счетчиках, вызывающий должен удерживать s.mu
+func (s *MemorySink) add(clicks []Click) {
+	for _, click := range clicks {
+		days, ok := s.daily[click.ShortID]
+		if !ok {
+			days = make(map[string]int)
+			s.daily[click.ShortID] = days
+		}
+		days[dayOf(click.Time)]++
+	}
+}
+
+// Close ничего не делает, переходы хранятся только в памяти
+func (s *MemorySink) Close() error {
+	return nil
+}
+
+func (s *MemorySink) Stats(ctx context.Context, shortID string) (Stats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stats := Stats{Daily: make([]DailyCount, 0, len(s.daily[shortID]))}
+	for day, count := range s.daily[shortID] {
+		stats.Total += count
+		stats.Daily = append(stats.Daily, DailyCount{Date: day, Count: count})
+	}
+	sort.Slice(
+		stats.Daily, func(i, j int) bool {
+			return stats.Daily[i].Date < stats.Daily[j].Date
+		},
+	)
+	return stats, nil
+}
@@ -0,0 +1,65 @@
+package analytics
+
+import (
+	"context"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"time"
+)
+
+// PostgresSink сохраняет переходы в таблицу clicks
+type PostgresSink struct {
+	pool *pgxpool.Pool
+}
+
+func NewPostgresSink(pool *pgxpool.Pool) *PostgresSink {
+	return &PostgresSink{pool: pool}
+}
+
+func (s *PostgresSink) SaveClicks(ctx context.Context, clicks []Click) error {
+	rows := make([][]interface{}, len(clicks))
+	for i, click := range clicks {
+		rows[i] = []interface{}{click.ShortID, click.Time, click.Referrer, click.UserAgent, click.IPHash}
+	}
+
+	// Пачка переходов записывается одной командой COPY
+	_, err := s.pool.CopyFrom(
+		ctx,
+		pgx.Identifier{"clicks"},
+		[]string{"idshorturl", "clicked_at", "referrer", "user_agent", "ip_hash"},
+		pgx.CopyFromRows(rows),
+	)
+	return err
+}
+
+// Close ничего не делает, пул подключений закрывает его владелец
+func (s *PostgresSink) Close() error {
+	return nil
+}
+
+func (s *PostgresSink) Stats(ctx context.Context, shortID string) (Stats, error) {
+	query := `
+		SELECT (clicked_at AT TIME ZONE 'UTC')::date AS day, count(*)
+		FROM clicks
+		WHERE IDshortURL = $1
+		GROUP BY day
+		ORDER BY day
+	`
+	rows, err := s.pool.Query(ctx, query, shortID)
+	if err != nil {
+		return Stats{}, err
+	}
+	defer rows.Close()
+
+	stats := Stats{Daily: make([]DailyCount, 0)}
+	for rows.Next() {
+		var day time.Time
+		var count int
+		if err := rows.Scan(&day, &count); err != nil {
+			return Stats{}, err
+		}
+		stats.Total += count
+		stats.Daily = append(stats.Daily, DailyCount{Date: day.Format("2006-01-02"), Count: count})
+	}
+	return stats, rows.Err()
+}
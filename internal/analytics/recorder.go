@@ -0,0 +1,121 @@
+package analytics
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Параметры буферизации переходов
+const (
+	bufferSize    = 4096
+	batchSize     = 256
+	flushInterval = time.Second
+)
+
+// Recorder принимает переходы без ожидания и асинхронно сохраняет их пачками
+type Recorder struct {
+	sink    Sink
+	ipKey   []byte // Секрет для HashIP
+	logger  *zap.Logger
+	clicks  chan Click
+	mu      sync.RWMutex
+	closed  bool
+	done    chan struct{}
+	dropped atomic.Int64
+}
+
+func NewRecorder(sink Sink, ipKey []byte, logger *zap.Logger) *Recorder {
+	r := &Recorder{
+		sink:   sink,
+		ipKey:  ipKey,
+		logger: logger,
+		clicks: make(chan Click, bufferSize),
+		done:   make(chan struct{}),
+	}
+
+	// Запуск горутины для сохранения переходов
+	go r.run()
+
+	return r
+}
+
+// Record ставит переход в очередь, при переполненном буфере переход отбрасывается
+func (r *Recorder) Record(click Click) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.closed {
+		return
+	}
+
+	select {
+	case r.clicks <- click:
+	default:
+		if r.dropped.Add(1)%1000 == 1 {
+			r.logger.Warn("Click buffer is full, dropping clicks", zap.Int64("dropped", r.dropped.Load()))
+		}
+	}
+}
+
+// HashIP хеширует адрес клиента секретом сервиса
+func (r *Recorder) HashIP(ip string) string {
+	return HashIP(r.ipKey, ip)
+}
+
+func (r *Recorder) Stats(ctx context.Context, shortID string) (Stats, error) {
+	return r.sink.Stats(ctx, shortID)
+}
+
+func (r *Recorder) run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]Click, 0, batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := r.sink.SaveClicks(context.Background(), batch); err != nil {
+			r.logger.Error("Error saving clicks", zap.Error(err), zap.Int("count", len(batch)))
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case click, ok := <-r.clicks:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, click)
+			if len(batch) >= batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// Stop прекращает прием переходов и дожидается сохранения уже принятых
+func (r *Recorder) Stop(ctx context.Context) error {
+	r.mu.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.clicks)
+	}
+	r.mu.Unlock()
+
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
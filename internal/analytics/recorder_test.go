@@ -0,0 +1,61 @@
+package analytics
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestRecorderFlushesOnStop(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "urls.json.clicks")
+	sink, err := NewFileSink(path, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := NewRecorder(sink, []byte("secret"), zap.NewNop())
+	day := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+	recorder.Record(Click{ShortID: "abc", Time: day})
+	recorder.Record(Click{ShortID: "abc", Time: day.Add(time.Hour)})
+	recorder.Record(Click{ShortID: "abc", Time: day.Add(24 * time.Hour)})
+	recorder.Record(Click{ShortID: "other", Time: day})
+
+	if err := recorder.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	sink.Close()
+
+	// Счетчики восстанавливаются из файла
+	restored, err := NewFileSink(path, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+
+	stats, err := restored.Stats(context.Background(), "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Total != 3 || len(stats.Daily) != 2 || stats.Daily[0] != (DailyCount{Date: "2023-10-01", Count: 2}) {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestRecorderHashIP(t *testing.T) {
+	recorder := NewRecorder(NewMemorySink(), []byte("secret"), zap.NewNop())
+	defer recorder.Stop(context.Background())
+
+	plain := sha256.Sum256([]byte("192.0.2.1"))
+	hash := recorder.HashIP("192.0.2.1")
+	if hash == hex.EncodeToString(plain[:16]) {
+		t.Errorf("IP hash does not depend on the key")
+	}
+	if hash != recorder.HashIP("192.0.2.1") || hash == HashIP([]byte("other"), "192.0.2.1") {
+		t.Errorf("IP hash is not stable for the same key")
+	}
+}
@@ -0,0 +1,123 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/egosha7/shortlink/internal/analytics"
+	"github.com/egosha7/shortlink/internal/auth"
+	"github.com/egosha7/shortlink/internal/config"
+	"github.com/egosha7/shortlink/internal/db"
+	"github.com/egosha7/shortlink/internal/metrics"
+	routes "github.com/egosha7/shortlink/internal/router"
+	"github.com/egosha7/shortlink/internal/storage"
+	"github.com/egosha7/shortlink/internal/worker"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+// App - собранный сервис: хранилища, фоновые задачи и HTTP-обработчик
+type App struct {
+	Handler http.Handler
+
+	logger  *zap.Logger
+	pool    *pgxpool.Pool
+	store   storage.Storage
+	sink    analytics.Sink
+	clicks  *analytics.Recorder
+	wkr     *worker.Worker
+	sweeper *worker.Sweeper
+}
+
+// New - функция для создания сервиса по конфигурации. К БД сервис подключается, только
+// если она задана, ошибка любой зависимости возвращается сразу с указанием ее источника
+func New(ctx context.Context, cfg *config.Config, keys *auth.KeySet, logger *zap.Logger) (*App, error) {
+	a := &App{logger: logger}
+
+	backend := storage.Backend(cfg)
+	logger.Info("Using storage", zap.String("backend", backend))
+
+	if backend == storage.BackendPostgres {
+		pool, err := db.Open(ctx, cfg.DataBase, cfg.DBMaxConns)
+		if err != nil {
+			return nil, err
+		}
+		a.pool = pool
+		metrics.RegisterPool(pool)
+	}
+
+	// Создание хранилища в соответствии с конфигурацией
+	store, err := storage.NewStorage(cfg, a.pool, logger)
+	if err != nil {
+		a.closeDB()
+		return nil, fmt.Errorf("create %s storage: %w", backend, err)
+	}
+	a.store = store
+
+	// Запись переходов по ссылкам
+	sink, err := analytics.NewSink(cfg, a.pool, logger)
+	if err != nil {
+		store.Close()
+		a.closeDB()
+		return nil, fmt.Errorf("create click storage: %w", err)
+	}
+	a.sink = sink
+
+	ipKey, err := analytics.IPKeyFromConfig(cfg, logger)
+	if err != nil {
+		sink.Close()
+		store.Close()
+		a.closeDB()
+		return nil, fmt.Errorf("create click IP key: %w", err)
+	}
+	a.clicks = analytics.NewRecorder(sink, ipKey, logger)
+
+	a.wkr = worker.NewWorker(store, cfg, logger)
+	metrics.RegisterDeleteQueue(a.wkr.QueueDepth)
+
+	if cfg.SweepInterval > 0 {
+		a.sweeper = worker.NewSweeper(store, cfg.SweepInterval, logger)
+	}
+
+	a.Handler = routes.SetupRoutes(
+		cfg, routes.Dependencies{
+			Store:   store,
+			Backend: backend,
+			Worker:  a.wkr,
+			Clicks:  a.clicks,
+			Keys:    keys,
+		}, logger,
+	)
+	return a, nil
+}
+
+// Shutdown останавливает сервис в порядке, обратном зависимостям: сначала задачи,
+// которые пишут в хранилища, затем сами хранилища и пул подключений к БД
+func (a *App) Shutdown(ctx context.Context) error {
+	var errs []error
+	if err := a.wkr.Stop(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("stop delete worker: %w", err))
+	}
+	if a.sweeper != nil {
+		a.sweeper.Stop()
+	}
+	if err := a.clicks.Stop(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("stop click recorder: %w", err))
+	}
+	if err := a.sink.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("close click storage: %w", err))
+	}
+	if err := a.store.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("close storage: %w", err))
+	}
+	a.closeDB()
+	return errors.Join(errs...)
+}
+
+func (a *App) closeDB() {
+	if a.pool != nil {
+		metrics.RegisterPool(nil)
+		a.pool.Close()
+	}
+}
@@ -0,0 +1,75 @@
+package app
+
+import (
+	"context"
+	"github.com/egosha7/shortlink/internal/auth"
+	"github.com/egosha7/shortlink/internal/config"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNewWithoutDatabase(t *testing.T) {
+	cfg := config.Default()
+	logger := zap.NewNop()
+
+	keys, err := auth.KeySetFromConfig(cfg, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := New(context.Background(), cfg, keys, logger)
+	if err != nil {
+		t.Fatalf("New without database: %v", err)
+	}
+	defer a.Shutdown(context.Background())
+
+	if a.pool != nil {
+		t.Errorf("database opened without DATABASE_DSN")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+	rr := httptest.NewRecorder()
+	a.Handler.ServeHTTP(rr, req)
+
+	// Проверяем код ответа и имя активного хранилища
+	if rr.Code != http.StatusOK {
+		t.Errorf("ping returned %d, want %d", rr.Code, http.StatusOK)
+	}
+	if !strings.Contains(rr.Body.String(), `"backend":"memory"`) {
+		t.Errorf("ping returned unexpected body: %s", rr.Body.String())
+	}
+}
+
+func TestNewInvalidDSN(t *testing.T) {
+	cfg := config.Default()
+	cfg.DataBase = "postgres://localhost:notaport/shortlink"
+
+	// Неверная строка подключения должна останавливать запуск, а не приводить к панике позже
+	if _, err := New(context.Background(), cfg, nil, zap.NewNop()); err == nil {
+		t.Fatal("New with invalid DSN returned no error")
+	}
+}
+
+func TestNewAfterShutdown(t *testing.T) {
+	cfg := config.Default()
+	logger := zap.NewNop()
+
+	keys, err := auth.KeySetFromConfig(cfg, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Метрики регистрируются глобально, повторное создание сервиса в процессе не должно паниковать
+	for i := 0; i < 2; i++ {
+		a, err := New(context.Background(), cfg, keys, logger)
+		if err != nil {
+			t.Fatalf("New #%d: %v", i+1, err)
+		}
+		if err = a.Shutdown(context.Background()); err != nil {
+			t.Fatalf("Shutdown #%d: %v", i+1, err)
+		}
+	}
+}
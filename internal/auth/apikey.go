@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+
+	"github.com/egosha7/shortlink/internal/helpers"
+)
+
+// APIKeyHeader - заголовок, в котором интеграции передают ключ доступа
+const APIKeyHeader = "X-API-Key"
+
+// Области доступа ключей
+const (
+	ScopeShorten = "shorten"
+	ScopeRead    = "read"
+	ScopeDelete  = "delete"
+)
+
+// Scopes - области доступа, которые можно выдать ключу
+var Scopes = []string{ScopeShorten, ScopeRead, ScopeDelete}
+
+// ValidateScopes - функция для проверки запрошенных для ключа областей доступа
+func ValidateScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return fmt.Errorf("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		known := false
+		for _, s := range Scopes {
+			if scope == s {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+	return nil
+}
+
+// GenerateAPIKey - функция для генерации ключа доступа, возвращает его ID и сам ключ
+func GenerateAPIKey() (string, string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+
+	id := helpers.GenerateID(8)
+	return id, "slk_" + id + "_" + hex.EncodeToString(secret), nil
+}
+
+// HashAPIKey - функция для получения хеша ключа, под которым он хранится
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// APIKeyFromRequest возвращает ключ доступа из заголовка X-API-Key
+func APIKeyFromRequest(r *http.Request) (string, bool) {
+	key := r.Header.Get(APIKeyHeader)
+	return key, key != ""
+}
+
+// HasScope сообщает, разрешена ли пользователю область доступа. Ограничения
+// действуют только для ключей доступа, кука и Bearer-токен дают полный доступ
+func (i Identity) HasScope(scope string) bool {
+	if i.Method != MethodAPIKey {
+		return true
+	}
+	for _, s := range i.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
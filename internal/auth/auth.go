@@ -2,7 +2,6 @@ package auth
 
 import (
 	"fmt"
-	"github.com/egosha7/shortlink/internal/helpers"
 	"net/http"
 	"time"
 
@@ -11,56 +10,41 @@ import (
 
 const CookieName = "USER_ID"
 
-// Функция для генерации симметрично подписанной куки с помощью JWT
-func SetSignedCookie(w http.ResponseWriter, userID string, secretKey []byte, expiration time.Duration) {
+// Sign подписывает токен с userID активным ключом и возвращает его вместе со сроком действия
+func (ks *KeySet) Sign(userID string, now time.Time) (string, time.Time, error) {
 	// Создаем новый токен
 	token := jwt.New(jwt.SigningMethodHS256)
+	token.Header["kid"] = ks.active.ID
 
 	// Устанавливаем идентификатор подписчика (subject) и значение userID в токене
 	claims := token.Claims.(jwt.MapClaims)
 	claims["sub"] = userID
 
 	// Устанавливаем срок действия токена
-	expirationTime := time.Now().Add(expiration)
+	expirationTime := now.Add(ks.ttl)
+	claims["iat"] = now.Unix()
 	claims["exp"] = expirationTime.Unix()
 
-	// Подписываем токен с использованием секретного ключа
-	tokenString, err := token.SignedString(secretKey)
+	// Подписываем токен с использованием активного ключа
+	tokenString, err := token.SignedString(ks.active.Secret)
 	if err != nil {
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		return
-	}
-
-	// Создаем новую куку с подписанным токеном
-	cookie := http.Cookie{
-		Name:     CookieName,
-		Value:    tokenString,
-		Expires:  expirationTime,
-		HttpOnly: true,
+		return "", time.Time{}, err
 	}
-
-	// Устанавливаем куку в ответе
-	http.SetCookie(w, &cookie)
+	return tokenString, expirationTime, nil
 }
 
-// Функция для проверки симметрично подписанной куки с помощью JWT
-func VerifySignedCookie(r *http.Request, secretKey []byte) (string, error) {
-	// Получаем значение куки из запроса
-	cookie, err := r.Cookie(CookieName)
-	if err != nil {
-		return "", fmt.Errorf("сookie not found")
-	}
-
-	// Проверяем подпись куки и получаем токен
+// Verify проверяет подпись и срок действия токена и возвращает userID
+func (ks *KeySet) Verify(tokenString string, now time.Time) (string, error) {
 	token, err := jwt.Parse(
-		cookie.Value, func(token *jwt.Token) (interface{}, error) {
+		tokenString, func(token *jwt.Token) (interface{}, error) {
 			// Проверяем, что используется правильный алгоритм подписи
 			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 				return nil, fmt.Errorf("unexpected signing method")
 			}
 
-			// Возвращаем секретный ключ для проверки подписи
-			return secretKey, nil
+			// Возвращаем ключ, которым подписан токен
+			kid, _ := token.Header["kid"].(string)
+			return ks.verificationKey(kid, now)
 		},
 	)
 
@@ -69,40 +53,42 @@ func VerifySignedCookie(r *http.Request, secretKey []byte) (string, error) {
 	}
 
 	// Проверяем, что токен действителен и получаем значение userID из токена
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		if userID, ok := claims["sub"].(string); ok {
+	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid && claims.VerifyExpiresAt(now.Unix(), true) {
+		if userID, ok := claims["sub"].(string); ok && userID != "" {
 			return userID, nil
 		}
 	}
 
-	return "", fmt.Errorf("invalid cookie")
+	return "", fmt.Errorf("invalid token")
 }
 
-func SetCookieHandler(w http.ResponseWriter, r *http.Request) string {
-
-	// Генерируем уникальный идентификатор пользователя
-	userID := helpers.GenerateID(8)
-
-	// Получаем секретный ключ для подписи
-	secretKey := []byte("your-secret-key")
+// Функция для генерации симметрично подписанной куки с помощью JWT
+func SetSignedCookie(w http.ResponseWriter, userID string, keys *KeySet) error {
+	tokenString, expirationTime, err := keys.Sign(userID, time.Now())
+	if err != nil {
+		return err
+	}
 
-	// Устанавливаем куку
-	SetSignedCookie(w, userID, secretKey, time.Hour*24)
+	// Создаем новую куку с подписанным токеном
+	cookie := http.Cookie{
+		Name:     CookieName,
+		Value:    tokenString,
+		Expires:  expirationTime,
+		HttpOnly: true,
+	}
 
-	// Отправляем ответ
-	return userID
+	// Устанавливаем куку в ответе
+	http.SetCookie(w, &cookie)
+	return nil
 }
 
-func GetCookieHandler(w http.ResponseWriter, r *http.Request) string {
-
-	// Получаем секретный ключ для подписи
-	secretKey := []byte("your-secret-key")
-
-	// Проверяем подпись и извлекаем userID
-	userID, err := VerifySignedCookie(r, secretKey)
+// Функция для проверки симметрично подписанной куки с помощью JWT
+func VerifySignedCookie(r *http.Request, keys *KeySet) (string, error) {
+	// Получаем значение куки из запроса
+	cookie, err := r.Cookie(CookieName)
 	if err != nil {
-		return ""
+		return "", fmt.Errorf("сookie not found")
 	}
 
-	return userID
+	return keys.Verify(cookie.Value, time.Now())
 }
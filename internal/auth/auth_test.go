@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestKeyRotation(t *testing.T) {
+	now := time.Now()
+	oldKey := Key{ID: "old", Secret: []byte("old-secret")}
+	newKey := Key{ID: "new", Secret: []byte("new-secret")}
+
+	oldKeys, err := NewKeySet(oldKey, nil, time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := oldKeys.Sign("user1", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Ключ выведен из обращения 10 минут назад, grace-период 30 минут
+	oldKey.RetiredAt = now.Add(-10 * time.Minute)
+	keys, err := NewKeySet(newKey, []Key{oldKey}, time.Hour, 30*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if userID, err := keys.Verify(token, now); err != nil || userID != "user1" {
+		t.Errorf("token within grace period rejected: %q, %v", userID, err)
+	}
+	if _, err := keys.Verify(token, now.Add(25*time.Minute)); err == nil {
+		t.Errorf("token signed with retired key accepted after grace period")
+	}
+	if _, err := keys.Verify(token, now.Add(2*time.Hour)); err == nil {
+		t.Errorf("expired token accepted")
+	}
+
+	forged, _, err := (&KeySet{active: Key{ID: "new", Secret: []byte("your-secret-key")}, ttl: time.Hour}).Sign("user2", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keys.Verify(forged, now); err == nil {
+		t.Errorf("forged token accepted")
+	}
+}
+
+func TestParseRetiredKeys(t *testing.T) {
+	keys, err := ParseRetiredKeys("k1:s:e@cret@2023-10-01T00:00:00Z, k2:other@2023-11-01T00:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0].ID != "k1" || string(keys[0].Secret) != "s:e@cret" || keys[1].RetiredAt.Month() != time.November {
+		t.Errorf("unexpected keys: %+v", keys)
+	}
+}
+
+func TestResolveIdentity(t *testing.T) {
+	keys, err := NewKeySet(Key{ID: "k1", Secret: []byte("secret")}, nil, time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Без куки выдается новый идентификатор
+	rr := httptest.NewRecorder()
+	identity, err := ResolveIdentity(rr, httptest.NewRequest("GET", "/", nil), keys)
+	if err != nil || identity.UserID == "" {
+		t.Fatalf("identity was not issued: %+v, %v", identity, err)
+	}
+	cookies := rr.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("got %d cookies, want 1", len(cookies))
+	}
+
+	// С действующей кукой используется ее идентификатор
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(cookies[0])
+	rr = httptest.NewRecorder()
+	if got, _ := ResolveIdentity(rr, req, keys); got.UserID != identity.UserID {
+		t.Errorf("valid cookie resolved as %+v", got)
+	}
+	if rr.Header().Get("Set-Cookie") != "" {
+		t.Errorf("cookie reissued for valid token")
+	}
+
+	// Поддельная кука заменяется новой
+	req = httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{Name: CookieName, Value: cookies[0].Value + "x"})
+	rr = httptest.NewRecorder()
+	if got, _ := ResolveIdentity(rr, req, keys); got.UserID == identity.UserID || rr.Header().Get("Set-Cookie") == "" {
+		t.Errorf("forged cookie resolved as %+v", got)
+	}
+}
+
+func TestResolveIdentityBearer(t *testing.T) {
+	keys, err := NewKeySet(Key{ID: "k1", Secret: []byte("secret")}, nil, time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := keys.Sign("user1", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	identity, err := ResolveIdentity(rr, req, keys)
+	if err != nil || identity.UserID != "user1" || identity.Method != MethodBearer {
+		t.Errorf("bearer token resolved as %+v, %v", identity, err)
+	}
+	if rr.Header().Get("Set-Cookie") != "" {
+		t.Errorf("cookie issued for bearer client")
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token+"x")
+	if _, err := ResolveIdentity(httptest.NewRecorder(), req, keys); err != ErrInvalidToken {
+		t.Errorf("invalid bearer token resolved with error %v", err)
+	}
+}
+
+func TestIdentityHasScope(t *testing.T) {
+	key := Identity{UserID: "user1", Method: MethodAPIKey, Scopes: []string{ScopeShorten}}
+	if !key.HasScope(ScopeShorten) || key.HasScope(ScopeDelete) {
+		t.Errorf("API key scopes not enforced: %v", key.Scopes)
+	}
+
+	cookie := Identity{UserID: "user1", Method: MethodCookie}
+	if !cookie.HasScope(ScopeDelete) {
+		t.Errorf("cookie identity must have every scope")
+	}
+
+	if err := ValidateScopes([]string{ScopeRead, "admin"}); err == nil {
+		t.Errorf("unknown scope accepted")
+	}
+}
@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/egosha7/shortlink/internal/helpers"
+)
+
+// Способы, которыми клиент подтвердил свой идентификатор
+const (
+	MethodCookie = "cookie"
+	MethodBearer = "bearer"
+	MethodAPIKey = "api_key"
+)
+
+// ErrInvalidToken - переданный в заголовке Authorization токен недействителен
+var ErrInvalidToken = errors.New("invalid bearer token")
+
+// Identity - пользователь, от имени которого выполняется запрос
+type Identity struct {
+	UserID string
+	Method string   // MethodCookie, MethodBearer или MethodAPIKey
+	Scopes []string // Области доступа ключа, заполняются только для MethodAPIKey
+}
+
+type identityKey struct{}
+
+// WithIdentity возвращает контекст с пользователем запроса
+func WithIdentity(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// FromContext возвращает пользователя запроса, заданного промежуточным обработчиком
+func FromContext(ctx context.Context) Identity {
+	identity, _ := ctx.Value(identityKey{}).(Identity)
+	return identity
+}
+
+// ResolveIdentity определяет пользователя по токену из заголовка Authorization или куки.
+// Недействительный Bearer-токен дает ErrInvalidToken, а при отсутствии, истечении или
+// подделке куки выдается новый идентификатор и в ответе устанавливается свежая кука.
+// Ошибка выдачи куки возвращается как есть, ответ при этом не записывается
+func ResolveIdentity(w http.ResponseWriter, r *http.Request, keys *KeySet) (Identity, error) {
+	if token, ok := BearerToken(r); ok {
+		userID, err := keys.Verify(token, time.Now())
+		if err != nil {
+			return Identity{}, ErrInvalidToken
+		}
+		return Identity{UserID: userID, Method: MethodBearer}, nil
+	}
+
+	if userID, err := VerifySignedCookie(r, keys); err == nil {
+		return Identity{UserID: userID, Method: MethodCookie}, nil
+	}
+
+	userID, err := SetCookieHandler(w, r, keys)
+	if err != nil {
+		return Identity{}, fmt.Errorf("issue cookie: %w", err)
+	}
+	return Identity{UserID: userID, Method: MethodCookie}, nil
+}
+
+// BearerToken возвращает токен из заголовка "Authorization: Bearer <token>"
+func BearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// SetCookieHandler выдает новый идентификатор пользователя и устанавливает куку с ним.
+// При ошибке подписи кука не устанавливается, ответ об ошибке пишет вызывающий
+func SetCookieHandler(w http.ResponseWriter, r *http.Request, keys *KeySet) (string, error) {
+
+	// Генерируем уникальный идентификатор пользователя
+	userID := helpers.GenerateID(8)
+
+	// Устанавливаем куку, подписанную активным ключом
+	if err := SetSignedCookie(w, userID, keys); err != nil {
+		return "", err
+	}
+
+	// Отправляем ответ
+	return userID, nil
+}
@@ -0,0 +1,140 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/egosha7/shortlink/internal/config"
+	"go.uber.org/zap"
+	"strings"
+	"time"
+)
+
+// Key - ключ подписи токенов, идентифицируемый в заголовке JWT полем kid
+type Key struct {
+	ID     string
+	Secret []byte
+	// RetiredAt - момент вывода ключа из обращения, нулевое значение у действующих ключей
+	RetiredAt time.Time
+}
+
+// KeySet - набор ключей: один активный для подписи и выведенные из обращения,
+// которые принимаются при проверке в течение grace-периода
+type KeySet struct {
+	active Key
+	keys   map[string]Key
+	ttl    time.Duration
+	grace  time.Duration
+}
+
+// NewKeySet - функция для создания набора ключей
+func NewKeySet(active Key, retired []Key, ttl time.Duration, grace time.Duration) (*KeySet, error) {
+	if active.ID == "" || len(active.Secret) == 0 {
+		return nil, errors.New("active key must have id and secret")
+	}
+	if !active.RetiredAt.IsZero() {
+		return nil, fmt.Errorf("active key %q is retired", active.ID)
+	}
+
+	keys := map[string]Key{active.ID: active}
+	for _, key := range retired {
+		if _, ok := keys[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate key id %q", key.ID)
+		}
+		if key.RetiredAt.IsZero() {
+			return nil, fmt.Errorf("retired key %q has no retirement time", key.ID)
+		}
+		keys[key.ID] = key
+	}
+
+	return &KeySet{
+		active: active,
+		keys:   keys,
+		ttl:    ttl,
+		grace:  grace,
+	}, nil
+}
+
+// ParseKey - функция для разбора ключа в формате "kid:secret" или "secret" с kid "default"
+func ParseKey(value string) Key {
+	id, secret, ok := strings.Cut(value, ":")
+	if !ok {
+		return Key{ID: "default", Secret: []byte(value)}
+	}
+	return Key{ID: id, Secret: []byte(secret)}
+}
+
+// ParseRetiredKeys - функция для разбора списка "kid:secret@RFC3339,..." выведенных из обращения ключей
+func ParseRetiredKeys(value string) ([]Key, error) {
+	var keys []Key
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		at := strings.LastIndex(item, "@")
+		if at < 0 {
+			return nil, fmt.Errorf("retired key %q has no retirement time", item)
+		}
+		retiredAt, err := time.Parse(time.RFC3339, item[at+1:])
+		if err != nil {
+			return nil, fmt.Errorf("retired key %q: %w", item[:at], err)
+		}
+
+		key := ParseKey(item[:at])
+		key.RetiredAt = retiredAt
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// RandomKey - функция для генерации случайного ключа, когда секрет не задан в конфигурации
+func RandomKey() (Key, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return Key{}, err
+	}
+	return Key{ID: hex.EncodeToString(secret[:4]), Secret: secret}, nil
+}
+
+// KeySetFromConfig - функция для создания набора ключей из конфигурации
+func KeySetFromConfig(cfg *config.Config, logger *zap.Logger) (*KeySet, error) {
+	var active Key
+	if cfg.SecretKey == "" {
+		// Без заданного ключа токены перестанут приниматься после перезапуска
+		logger.Warn("Secret key is not set, using a random key")
+		key, err := RandomKey()
+		if err != nil {
+			return nil, err
+		}
+		active = key
+	} else {
+		active = ParseKey(cfg.SecretKey)
+	}
+
+	retired, err := ParseRetiredKeys(cfg.RetiredKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewKeySet(active, retired, cfg.TokenTTL, cfg.KeyGracePeriod)
+}
+
+// TTL возвращает срок действия выпускаемых токенов
+func (ks *KeySet) TTL() time.Duration {
+	return ks.ttl
+}
+
+// verificationKey возвращает секрет для проверки подписи токена с указанным kid
+func (ks *KeySet) verificationKey(kid string, now time.Time) ([]byte, error) {
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	if !key.RetiredAt.IsZero() && now.After(key.RetiredAt.Add(ks.grace)) {
+		return nil, fmt.Errorf("key %q is retired", kid)
+	}
+	return key.Secret, nil
+}
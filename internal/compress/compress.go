@@ -5,27 +5,63 @@ import (
 	"net/http"
 )
 
-type GzipMiddleware struct{}
+// Значения по умолчанию для незаданных полей GzipMiddleware
+const (
+	defaultMinSize     = 1024
+	defaultMaxBodySize = 1 << 20
+)
+
+// GzipMiddleware распаковывает тела запросов в gzip и сжимает ответы
+// в кодировке, выбранной по заголовку Accept-Encoding: br, gzip или deflate
+type GzipMiddleware struct {
+	// MinSize - размер ответа, начиная с которого он сжимается
+	MinSize int
+	// MaxBodySize - предельный размер распакованного тела запроса
+	MaxBodySize int64
+}
 
 func (m *GzipMiddleware) Apply(next http.Handler) http.Handler {
+	minSize := m.MinSize
+	if minSize <= 0 {
+		minSize = defaultMinSize
+	}
+	maxBodySize := m.MaxBodySize
+	if maxBodySize <= 0 {
+		maxBodySize = defaultMaxBodySize
+	}
+
 	return http.HandlerFunc(
 		func(w http.ResponseWriter, r *http.Request) {
 			if r.Header.Get(`Content-Encoding`) == `gzip` {
 				gz, err := gzip.NewReader(r.Body)
 				if err != nil {
-					http.Error(w, err.Error(), http.StatusInternalServerError)
+					http.Error(w, "Invalid gzip body", http.StatusBadRequest)
 					return
 				}
 				defer gz.Close()
 
-				// Замена тела запроса на распакованное содержимое
-				r.Body = http.MaxBytesReader(w, gz, r.ContentLength)
+				// Замена тела запроса на распакованное содержимое. Предел задается для
+				// распакованных данных: сжатый ContentLength ничего не говорит о их размере
+				r.Body = http.MaxBytesReader(w, gz, maxBodySize)
+				r.ContentLength = -1
 				r.Header.Del("Content-Encoding")
 				r.Header.Del("Content-Length")
 			}
 
-			// Передаем управление следующему обработчику
-			next.ServeHTTP(w, r)
+			// Ответ зависит от Accept-Encoding, это нужно учитывать кешам
+			w.Header().Add("Vary", "Accept-Encoding")
+
+			encoding := negotiate(r.Header.Get("Accept-Encoding"))
+			if encoding == "" || r.Method == http.MethodHead {
+				// Передаем управление следующему обработчику
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{ResponseWriter: w, encoding: encoding, minSize: minSize}
+			defer cw.Close()
+
+			next.ServeHTTP(cw, r)
 		},
 	)
 }
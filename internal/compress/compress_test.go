@@ -0,0 +1,117 @@
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", ""},
+		{"gzip", "gzip"},
+		{"gzip, deflate, br", "br"},
+		{"gzip;q=1.0, br;q=0.5", "gzip"},
+		{"br;q=0, *", "gzip"},
+		{"identity", ""},
+		{"deflate;q=0.2, gzip;q=0", "deflate"},
+	}
+	for _, tt := range tests {
+		if got := negotiate(tt.header); got != tt.want {
+			t.Errorf("negotiate(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func serve(handler http.HandlerFunc, req *http.Request) *httptest.ResponseRecorder {
+	m := &GzipMiddleware{MinSize: 64}
+	rec := httptest.NewRecorder()
+	m.Apply(handler).ServeHTTP(rec, req)
+	return rec
+}
+
+func TestResponseCompression(t *testing.T) {
+	body := `{"result":"` + strings.Repeat("a", 200) + `"}`
+	jsonHandler := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, body)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/shorten", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := serve(jsonHandler, req)
+	if rec.Code != http.StatusCreated || rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("expected gzip response, got %d %q", rec.Code, rec.Header().Get("Content-Encoding"))
+	}
+	gz, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := io.ReadAll(gz); string(got) != body {
+		t.Errorf("decompressed body mismatch: %q", got)
+	}
+
+	req.Header.Set("Accept-Encoding", "br")
+	rec = serve(jsonHandler, req)
+	if got, _ := io.ReadAll(brotli.NewReader(rec.Body)); string(got) != body {
+		t.Errorf("brotli body mismatch: %q", got)
+	}
+
+	// Короткий ответ не сжимается
+	rec = serve(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			io.WriteString(w, "short")
+		}, req,
+	)
+	if rec.Header().Get("Content-Encoding") != "" || rec.Body.String() != "short" {
+		t.Errorf("short response compressed: %q", rec.Header().Get("Content-Encoding"))
+	}
+
+	// Перенаправление не сжимается
+	rec = serve(
+		func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "http://example.com/"+strings.Repeat("a", 200), http.StatusTemporaryRedirect)
+		}, httptest.NewRequest(http.MethodGet, "/abc", nil),
+	)
+	if rec.Code != http.StatusTemporaryRedirect || rec.Header().Get("Content-Encoding") != "" {
+		t.Errorf("redirect compressed: %d %q", rec.Code, rec.Header().Get("Content-Encoding"))
+	}
+}
+
+func TestRequestBodyLimit(t *testing.T) {
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write(bytes.Repeat([]byte("a"), 10000))
+	gz.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(compressed.Bytes()))
+	req.Header.Set("Content-Encoding", "gzip")
+
+	// Сжатое тело меньше предела, но распакованное - больше
+	var readErr error
+	m := &GzipMiddleware{MaxBodySize: 5000}
+	m.Apply(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				_, readErr = io.ReadAll(r.Body)
+			},
+		),
+	).ServeHTTP(httptest.NewRecorder(), req)
+
+	var maxErr *http.MaxBytesError
+	if !errors.As(readErr, &maxErr) {
+		t.Errorf("expected body limit error, got %v", readErr)
+	}
+}
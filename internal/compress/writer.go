@@ -0,0 +1,235 @@
+package compress
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Поддерживаемые кодировки ответа в порядке предпочтения сервера при равных весах клиента
+const (
+	encodingBrotli  = "br"
+	encodingGzip    = "gzip"
+	encodingDeflate = "deflate"
+)
+
+var serverPreference = []string{encodingBrotli, encodingGzip, encodingDeflate}
+
+// encoder - общий интерфейс писателей gzip, deflate и brotli для переиспользования через пул
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// Писатели дорого создавать, поэтому они переиспользуются между запросами
+var encoderPools = map[string]*sync.Pool{
+	encodingBrotli: {New: func() interface{} {
+		return brotli.NewWriterLevel(io.Discard, brotli.DefaultCompression)
+	}},
+	encodingGzip: {New: func() interface{} {
+		return gzip.NewWriter(io.Discard)
+	}},
+	encodingDeflate: {New: func() interface{} {
+		w, _ := flate.NewWriter(io.Discard, flate.DefaultCompression)
+		return w
+	}},
+}
+
+// negotiate выбирает кодировку ответа по заголовку Accept-Encoding с учетом весов q,
+// пустая строка означает ответ без сжатия
+func negotiate(header string) string {
+	weights := make(map[string]float64)
+	wildcard := -1.0
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+
+		if name == "*" {
+			wildcard = q
+		} else {
+			weights[name] = q
+		}
+	}
+
+	candidates := make([]string, 0, len(serverPreference))
+	for _, name := range serverPreference {
+		q, ok := weights[name]
+		if !ok {
+			q = wildcard
+		}
+		if q > 0 {
+			weights[name] = q
+			candidates = append(candidates, name)
+		}
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+
+	sort.SliceStable(
+		candidates, func(i, j int) bool {
+			return weights[candidates[i]] > weights[candidates[j]]
+		},
+	)
+	return candidates[0]
+}
+
+// compressible сообщает, имеет ли смысл сжимать ответ с таким типом содержимого
+func compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(mediaType, "text/") ||
+		mediaType == "application/json" ||
+		strings.HasSuffix(mediaType, "+json")
+}
+
+// compressibleStatus сообщает, может ли ответ с таким статусом иметь сжимаемое тело.
+// Перенаправления не сжимаются: их тело браузер не показывает
+func compressibleStatus(status int) bool {
+	return status >= http.StatusOK &&
+		status != http.StatusNoContent &&
+		status != http.StatusNotModified &&
+		(status < 300 || status >= 400)
+}
+
+// compressWriter копит начало ответа и включает сжатие, только если тело достигло minSize
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	minSize  int
+
+	status      int
+	wroteHeader bool
+	decided     bool // Решение о сжатии принято, заголовки отправлены клиенту
+	buf         []byte
+	enc         encoder
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+	cw.status = status
+
+	h := cw.Header()
+	if !compressibleStatus(status) || h.Get("Content-Encoding") != "" ||
+		(h.Get("Content-Type") != "" && !compressible(h.Get("Content-Type"))) {
+		cw.passThrough()
+	}
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.decided {
+		if cw.enc != nil {
+			return cw.enc.Write(p)
+		}
+		return cw.ResponseWriter.Write(p)
+	}
+
+	cw.buf = append(cw.buf, p...)
+	if len(cw.buf) >= cw.minSize {
+		if err := cw.decide(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush отправляет накопленное клиенту, решение о сжатии принимается досрочно
+func (cw *compressWriter) Flush() {
+	if !cw.decided && cw.wroteHeader {
+		cw.decide()
+	}
+	if cw.enc != nil {
+		cw.enc.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// decide включает сжатие для накопленного тела, если тип содержимого сжимаемый
+func (cw *compressWriter) decide() error {
+	h := cw.Header()
+	if h.Get("Content-Type") == "" {
+		// Тип не задан обработчиком, определяем его так же, как net/http
+		h.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+	if !compressible(h.Get("Content-Type")) {
+		return cw.passThrough()
+	}
+
+	h.Set("Content-Encoding", cw.encoding)
+	h.Del("Content-Length")
+	cw.decided = true
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	cw.enc = encoderPools[cw.encoding].Get().(encoder)
+	cw.enc.Reset(cw.ResponseWriter)
+
+	buf := cw.buf
+	cw.buf = nil
+	_, err := cw.enc.Write(buf)
+	return err
+}
+
+// passThrough отправляет ответ без сжатия
+func (cw *compressWriter) passThrough() error {
+	cw.decided = true
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	_, err := cw.ResponseWriter.Write(buf)
+	return err
+}
+
+// Close дописывает тело: короткие ответы отправляются без сжатия, писатель возвращается в пул
+func (cw *compressWriter) Close() error {
+	if !cw.decided {
+		if !cw.wroteHeader {
+			// Обработчик ничего не записал
+			return nil
+		}
+		return cw.passThrough()
+	}
+	if cw.enc == nil {
+		return nil
+	}
+
+	err := cw.enc.Close()
+	cw.enc.Reset(io.Discard)
+	encoderPools[cw.encoding].Put(cw.enc)
+	cw.enc = nil
+	return err
+}
@@ -0,0 +1,33 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+		ok     bool
+	}{
+		{"defaults", func(c *Config) {}, true},
+		{"address without port", func(c *Config) { c.Addr = "localhost" }, false},
+		{"base URL without scheme", func(c *Config) { c.BaseURL = "localhost:8080" }, false},
+		{"zero body size", func(c *Config) { c.MaxBodySize = 0 }, false},
+		{"negative storage timeout", func(c *Config) { c.StorageWriteTimeout = -time.Second }, false},
+		{"negative pool size", func(c *Config) { c.DBMaxConns = -1 }, false},
+		{"no delete workers", func(c *Config) { c.DeleteWorkers = 0 }, false},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				cfg := Default()
+				tt.modify(cfg)
+				if err := cfg.Validate(); (err == nil) != tt.ok {
+					t.Errorf("Validate() = %v, want ok %v", err, tt.ok)
+				}
+			},
+		)
+	}
+}
@@ -2,25 +2,91 @@ package cookiemw
 
 import (
 	"context"
+	"errors"
 	"github.com/egosha7/shortlink/internal/auth"
-	"github.com/egosha7/shortlink/internal/handlers"
+	"github.com/egosha7/shortlink/internal/loger"
+	"github.com/egosha7/shortlink/internal/storage"
 	"net/http"
 )
 
-func CookieMiddleware(next http.Handler) http.Handler {
+// CookieMiddleware определяет пользователя по ключу доступа, Bearer-токену или куке
+// и кладет его в контекст запроса, обработчики получают его через auth.FromContext
+func CookieMiddleware(keys *auth.KeySet, apiKeys storage.APIKeyStorage) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				// Ключ доступа интеграции имеет приоритет над токенами
+				if key, ok := auth.APIKeyFromRequest(r); ok {
+					ctx, cancel := storage.ReadContext(r.Context())
+					apiKey, err := apiKeys.GetAPIKeyByHash(ctx, auth.HashAPIKey(key))
+					cancel()
+					switch {
+					case errors.Is(err, storage.ErrNotFound):
+						http.Error(w, "Unauthorized", http.StatusUnauthorized)
+						return
+					case errors.Is(err, context.DeadlineExceeded):
+						// Хранилище не ответило вовремя, ключ мог быть действительным
+						loger.SetError(r.Context(), err)
+						http.Error(w, "Gateway Timeout", http.StatusGatewayTimeout)
+						return
+					case err != nil:
+						loger.SetError(r.Context(), err)
+						w.Header().Set("Retry-After", "1")
+						http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+						return
+					}
+
+					identity := auth.Identity{UserID: apiKey.UserID, Method: auth.MethodAPIKey, Scopes: apiKey.Scopes}
+					loger.SetUserID(r.Context(), identity.UserID)
+					next.ServeHTTP(w, r.WithContext(auth.WithIdentity(r.Context(), identity)))
+					return
+				}
+
+				// Проверяем токен, при необходимости выдаем новую куку
+				identity, err := auth.ResolveIdentity(w, r, keys)
+				switch {
+				case errors.Is(err, auth.ErrInvalidToken):
+					w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+					http.Error(w, "Unauthorized", http.StatusUnauthorized)
+					return
+				case err != nil:
+					loger.SetError(r.Context(), err)
+					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+					return
+				}
+				r = r.WithContext(auth.WithIdentity(r.Context(), identity))
+				loger.SetUserID(r.Context(), identity.UserID)
+
+				// Продолжаем выполнение следующего обработчика
+				next.ServeHTTP(w, r)
+			},
+		)
+	}
+}
+
+// RequireScope пропускает запрос, только если пользователю разрешена область доступа scope
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				if !auth.FromContext(r.Context()).HasScope(scope) {
+					http.Error(w, "Forbidden", http.StatusForbidden)
+					return
+				}
+				next.ServeHTTP(w, r)
+			},
+		)
+	}
+}
+
+// RequireSession запрещает запрос с ключом доступа, например управление самими ключами
+func RequireSession(next http.Handler) http.Handler {
 	return http.HandlerFunc(
 		func(w http.ResponseWriter, r *http.Request) {
-			// Получаем значение куки
-
-			cookie, err := r.Cookie(auth.CookieName)
-			if err != nil || cookie == nil {
-				// Кука не существует
-				id := auth.SetCookieHandler(w, r)
-				ctx := context.WithValue(r.Context(), handlers.UserIDKey, id)
-				r = r.WithContext(ctx)
+			if auth.FromContext(r.Context()).Method == auth.MethodAPIKey {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
 			}
-
-			// Продолжаем выполнение следующего обработчика
 			next.ServeHTTP(w, r)
 		},
 	)
@@ -2,37 +2,27 @@ package db
 
 import (
 	"context"
-	"github.com/egosha7/shortlink/internal/config"
-	"github.com/jackc/pgx/v4"
-	"net/http"
+	"fmt"
+	"github.com/jackc/pgx/v4/pgxpool"
 )
 
-func ConnectToDB(cfg *config.Config) (*pgx.Conn, error) {
-
-	if cfg.DataBase == "" {
-		// Возвращаем nil, если строка подключения пуста
-		conn := &pgx.Conn{}
-		return conn, nil
-	}
-
-	connConfig, err := pgx.ParseConfig(cfg.DataBase)
+// Open - функция для создания пула подключений к БД. Если maxConns больше нуля, он задает
+// размер пула, иначе используется pool_max_conns из строки подключения или значение pgx.
+// Ошибка разбора строки подключения или недоступность БД возвращаются сразу, чтобы
+// сервис не запускался с неработающим хранилищем
+func Open(ctx context.Context, dsn string, maxConns int32) (*pgxpool.Pool, error) {
+	poolConfig, err := pgxpool.ParseConfig(dsn)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("invalid database DSN: %w", err)
 	}
-
-	conn, err := pgx.ConnectConfig(context.Background(), connConfig)
-	if err != nil {
-		return nil, err
+	if maxConns > 0 {
+		poolConfig.MaxConns = maxConns
 	}
-	return conn, nil
-}
 
-func PingDB(w http.ResponseWriter, r *http.Request, conn *pgx.Conn) {
-	err := conn.Ping(context.Background())
+	// Создание пула подключений, первое соединение открывается сразу
+	pool, err := pgxpool.ConnectConfig(ctx, poolConfig)
 	if err != nil {
-		http.Error(w, "Database connection error", http.StatusInternalServerError)
-		return
+		return nil, fmt.Errorf("connect to database: %w", err)
 	}
-
-	w.WriteHeader(http.StatusOK)
+	return pool, nil
 }
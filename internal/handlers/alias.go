@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// Ограничения на длину пользовательского псевдонима ссылки
+const (
+	aliasMinLen = 3
+	aliasMaxLen = 64
+)
+
+var aliasPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Псевдонимы, совпадающие с путями сервиса
+var reservedAliases = map[string]struct{}{
+	"ping":    {},
+	"api":     {},
+	"cookie":  {},
+	"metrics": {},
+}
+
+// validateAlias - функция для проверки заданного клиентом короткого ID: псевдонима ссылки
+// или correlation_id записи пакета. Поле указывается в FieldError, поэтому текст ошибок без него
+func validateAlias(alias string) error {
+	if len(alias) < aliasMinLen || len(alias) > aliasMaxLen {
+		return errors.New("must be from 3 to 64 characters long")
+	}
+	if !aliasPattern.MatchString(alias) {
+		return errors.New("may contain only latin letters, digits, '-' and '_'")
+	}
+	if _, ok := reservedAliases[strings.ToLower(alias)]; ok {
+		return errors.New("is reserved")
+	}
+	return nil
+}
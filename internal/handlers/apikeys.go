@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/egosha7/shortlink/internal/auth"
+	"github.com/egosha7/shortlink/internal/loger"
+	"github.com/egosha7/shortlink/internal/storage"
+	"github.com/go-chi/chi"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+)
+
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+type apiKeyResponse struct {
+	ID        string    `json:"id"`
+	Key       string    `json:"key,omitempty"` // Сам ключ возвращается только при создании
+	Name      string    `json:"name"`
+	Scopes    []string  `json:"scopes"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreateAPIKeyHandler выпускает ключ доступа для интеграций текущего пользователя
+func CreateAPIKeyHandler(w http.ResponseWriter, r *http.Request, store storage.APIKeyStorage, logger *zap.Logger) {
+	userID := auth.FromContext(r.Context()).UserID
+	if userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	if err := auth.ValidateScopes(req.Scopes); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id, key, err := auth.GenerateAPIKey()
+	if err != nil {
+		loger.FromContext(r.Context(), logger).Error("Error generating API key", zap.Error(err))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	apiKey := storage.APIKey{
+		ID:        id,
+		UserID:    userID,
+		Name:      req.Name,
+		Hash:      auth.HashAPIKey(key),
+		Scopes:    req.Scopes,
+		CreatedAt: time.Now().UTC(),
+	}
+	ctx, cancel := storage.WriteContext(r.Context())
+	defer cancel()
+
+	if err = store.AddAPIKey(ctx, apiKey); err != nil {
+		writeStorageError(w, ctx, err)
+		return
+	}
+
+	response := apiKeyResponse{
+		ID:        apiKey.ID,
+		Key:       key,
+		Name:      apiKey.Name,
+		Scopes:    apiKey.Scopes,
+		CreatedAt: apiKey.CreatedAt,
+	}
+
+	// Отправка ответа в формате JSON
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// ListAPIKeysHandler возвращает ключи доступа пользователя без самих ключей
+func ListAPIKeysHandler(w http.ResponseWriter, r *http.Request, store storage.APIKeyStorage) {
+	userID := auth.FromContext(r.Context()).UserID
+	if userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ctx, cancel := storage.ReadContext(r.Context())
+	defer cancel()
+
+	keys, err := store.GetAPIKeysByUserID(ctx, userID)
+	if err != nil {
+		writeStorageError(w, ctx, err)
+		return
+	}
+	if len(keys) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	response := make([]apiKeyResponse, 0, len(keys))
+	for _, k := range keys {
+		response = append(
+			response, apiKeyResponse{
+				ID:        k.ID,
+				Name:      k.Name,
+				Scopes:    k.Scopes,
+				CreatedAt: k.CreatedAt,
+			},
+		)
+	}
+
+	// Отправка ответа в формате JSON
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// DeleteAPIKeyHandler отзывает ключ доступа пользователя
+func DeleteAPIKeyHandler(w http.ResponseWriter, r *http.Request, store storage.APIKeyStorage) {
+	userID := auth.FromContext(r.Context()).UserID
+	if userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ctx, cancel := storage.WriteContext(r.Context())
+	defer cancel()
+
+	if err := store.DeleteAPIKey(ctx, chi.URLParam(r, "id"), userID); err != nil {
+		writeStorageError(w, ctx, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
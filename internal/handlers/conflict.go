@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/egosha7/shortlink/internal/storage"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Заголовки ответа POST / с метаданными уже сохраненной ссылки, тело ответа - короткая ссылка
+const (
+	headerCreatedAt = "X-Created-At"
+	headerOwned     = "X-Owned"
+)
+
+// existingLink - сведения об уже сохраненной ссылке, которые клиент получает при конфликте
+type existingLink struct {
+	CreatedAt *time.Time `json:"created_at,omitempty"` // Неизвестен у ссылок, сохраненных до его появления
+	Owned     bool       `json:"owned"`                // Ссылку сохранил сам вызывающий
+}
+
+// newExistingLink - функция для описания уже сохраненной ссылки с точки зрения пользователя userID
+func newExistingLink(res storage.AddResult, userID string) existingLink {
+	link := existingLink{Owned: userID != "" && res.UserID == userID}
+	if !res.CreatedAt.IsZero() {
+		createdAt := res.CreatedAt.UTC()
+		link.CreatedAt = &createdAt
+	}
+	return link
+}
+
+// setHeaders передает сведения о ссылке в заголовках ответа
+func (l existingLink) setHeaders(w http.ResponseWriter) {
+	if l.CreatedAt != nil {
+		w.Header().Set(headerCreatedAt, l.CreatedAt.Format(time.RFC3339))
+	}
+	w.Header().Set(headerOwned, strconv.FormatBool(l.Owned))
+}
+
+// shortenConflict - ответ POST /api/shorten, если URL уже сохранен
+type shortenConflict struct {
+	Result string `json:"result"`
+	existingLink
+}
+
+// batchConflict - запись пакета, URL которой уже сохранен
+type batchConflict struct {
+	CorrelationID string `json:"correlation_id"`
+	ShortURL      string `json:"short_url"`
+	existingLink
+}
+
+// writeBatchConflict - функция для ответа 409 со списком уже сохраненных ссылок пакета
+func writeBatchConflict(w http.ResponseWriter, BaseURL string, userID string, err *storage.BatchConflictError) {
+	response := make([]batchConflict, 0, len(err.Conflicts))
+	for _, c := range err.Conflicts {
+		response = append(
+			response, batchConflict{
+				CorrelationID: c.CorrelationID,
+				ShortURL:      BaseURL + "/" + c.Existing.ID,
+				existingLink:  newExistingLink(c.Existing, userID),
+			},
+		)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/egosha7/shortlink/internal/auth"
+	"github.com/egosha7/shortlink/internal/storage"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShortenConflictResponses(t *testing.T) {
+	const baseURL = "http://localhost:8080"
+
+	store := storage.NewMemoryStore(zap.NewNop())
+	created, err := store.AddURL(context.Background(), "abc123", "http://example.com", "owner", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	createdAt := created.CreatedAt.UTC().Format(time.RFC3339Nano)
+
+	// Все три способа сокращения при конфликте отдают полную ссылку и ее метаданные
+	for _, userID := range []string{"owner", "stranger"} {
+		owned := userID == "owner"
+		ctx := auth.WithIdentity(context.Background(), auth.Identity{UserID: userID})
+
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("http://example.com/")).WithContext(ctx)
+		rr := httptest.NewRecorder()
+		ShortenURL(rr, req, baseURL, store, zap.NewNop())
+
+		if rr.Code != http.StatusConflict || rr.Body.String() != baseURL+"/abc123" {
+			t.Errorf("POST / as %s: got %d %q", userID, rr.Code, rr.Body.String())
+		}
+		if got := rr.Header().Get(headerOwned); got != strconv.FormatBool(owned) {
+			t.Errorf("POST / as %s: got %s %q", userID, headerOwned, got)
+		}
+		if rr.Header().Get(headerCreatedAt) == "" {
+			t.Errorf("POST / as %s: no %s header", userID, headerCreatedAt)
+		}
+
+		req = httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(`{"url":"http://example.com"}`)).WithContext(ctx)
+		rr = httptest.NewRecorder()
+		HandleShortenURL(rr, req, baseURL, store)
+
+		var single struct {
+			Result    string `json:"result"`
+			CreatedAt string `json:"created_at"`
+			Owned     bool   `json:"owned"`
+		}
+		if rr.Code != http.StatusConflict {
+			t.Errorf("POST /api/shorten as %s: got status %d", userID, rr.Code)
+		}
+		if err = json.Unmarshal(rr.Body.Bytes(), &single); err != nil {
+			t.Fatal(err)
+		}
+		if single.Result != baseURL+"/abc123" || single.CreatedAt != createdAt || single.Owned != owned {
+			t.Errorf("POST /api/shorten as %s: got %+v", userID, single)
+		}
+
+		body := `[{"correlation_id":"item-x1","original_url":"http://new.example.com"},{"correlation_id":"item-x2","original_url":"http://EXAMPLE.com"}]`
+		req = httptest.NewRequest(http.MethodPost, "/api/shorten/batch", strings.NewReader(body)).WithContext(ctx)
+		rr = httptest.NewRecorder()
+		HandleShortenBatch(rr, req, baseURL, store)
+
+		var batch []struct {
+			CorrelationID string `json:"correlation_id"`
+			ShortURL      string `json:"short_url"`
+			CreatedAt     string `json:"created_at"`
+			Owned         bool   `json:"owned"`
+		}
+		if rr.Code != http.StatusConflict {
+			t.Errorf("POST /api/shorten/batch as %s: got status %d", userID, rr.Code)
+		}
+		if err = json.Unmarshal(rr.Body.Bytes(), &batch); err != nil {
+			t.Fatal(err)
+		}
+		if len(batch) != 1 || batch[0].CorrelationID != "item-x2" || batch[0].ShortURL != baseURL+"/abc123" ||
+			batch[0].CreatedAt != createdAt || batch[0].Owned != owned {
+			t.Errorf("POST /api/shorten/batch as %s: got %+v", userID, batch)
+		}
+	}
+}
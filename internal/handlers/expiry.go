@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// resolveExpiresAt - функция для вычисления срока жизни ссылки по expires_at или ttl
+func resolveExpiresAt(expiresAt *time.Time, ttl string, now time.Time) (*time.Time, error) {
+	if expiresAt != nil && ttl != "" {
+		return nil, errors.New("only one of expires_at and ttl may be set")
+	}
+
+	if ttl != "" {
+		d, err := time.ParseDuration(ttl)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ttl: %w", err)
+		}
+		if d <= 0 {
+			return nil, errors.New("ttl must be positive")
+		}
+		t := now.Add(d)
+		return &t, nil
+	}
+
+	if expiresAt != nil && !expiresAt.After(now) {
+		return nil, errors.New("expires_at must be in the future")
+	}
+	return expiresAt, nil
+}
+
+// resolveRecordExpiresAt приводит expires_at и ttl записи пакета к полю expires_at в формате RFC 3339
+func resolveRecordExpiresAt(record map[string]string, now time.Time) error {
+	var expiresAt *time.Time
+	if value := record["expires_at"]; value != "" {
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return fmt.Errorf("invalid expires_at: %w", err)
+		}
+		expiresAt = &t
+	}
+
+	resolved, err := resolveExpiresAt(expiresAt, record["ttl"], now)
+	if err != nil {
+		return err
+	}
+
+	delete(record, "ttl")
+	delete(record, "expires_at")
+	if resolved != nil {
+		record["expires_at"] = resolved.UTC().Format(time.RFC3339)
+	}
+	return nil
+}
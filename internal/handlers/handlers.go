@@ -1,35 +1,26 @@
 package handlers
 
 import (
-	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/egosha7/shortlink/internal/analytics"
 	"github.com/egosha7/shortlink/internal/auth"
 	"github.com/egosha7/shortlink/internal/helpers"
+	"github.com/egosha7/shortlink/internal/loger"
+	"github.com/egosha7/shortlink/internal/metrics"
 	"github.com/egosha7/shortlink/internal/storage"
 	"github.com/egosha7/shortlink/internal/worker"
 	"github.com/go-chi/chi"
 	"go.uber.org/zap"
 	"io"
+	"net"
 	"net/http"
-	"strings"
+	"time"
 )
 
-type Key string
-
-type ContextKey string
-
-const UserIDKey ContextKey = "userID"
-
 func DeleteUserURLsHandler(w http.ResponseWriter, r *http.Request, wkr *worker.Worker) {
-	userID := auth.GetCookieHandler(w, r)
-	setCookieHeader := w.Header().Get("Set-Cookie")
-	if setCookieHeader != "" {
-		fmt.Println("Cookie set in the response:", setCookieHeader)
-		userID = r.Context().Value(UserIDKey).(string)
-		newCtx := context.WithValue(r.Context(), UserIDKey, "")
-		r = r.WithContext(newCtx)
-	}
+	userID := auth.FromContext(r.Context()).UserID
 
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
@@ -45,22 +36,21 @@ func DeleteUserURLsHandler(w http.ResponseWriter, r *http.Request, wkr *worker.W
 	}
 
 	// Отправляем ссылки и userID в канал через метод DeleteURLs экземпляра worker
-	wkr.DeleteURLs(urls, userID)
+	if err = wkr.DeleteURLs(r.Context(), urls, userID); err != nil {
+		// Очередь переполнена или сервер останавливается, клиенту стоит повторить запрос позже
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+		return
+	}
 
 	// Возвращаем статус 202 Accepted
 	w.WriteHeader(http.StatusAccepted)
 }
 
-func GetUserURLsHandler(w http.ResponseWriter, r *http.Request, BaseURL string, store *storage.URLStore, logger *zap.Logger) {
-	// Получение идентификатора пользователя из куки
-	userID := auth.GetCookieHandler(w, r)
-	setCookieHeader := w.Header().Get("Set-Cookie")
-	if setCookieHeader != "" {
-		logger.Info("Cookie set in the response:" + setCookieHeader)
-		userID = r.Context().Value(UserIDKey).(string)
-		newCtx := context.WithValue(r.Context(), UserIDKey, "")
-		r = r.WithContext(newCtx)
-	} else if userID == "" {
+func GetUserURLsHandler(w http.ResponseWriter, r *http.Request, BaseURL string, store storage.Storage, logger *zap.Logger) {
+	// Получение идентификатора пользователя из контекста запроса
+	userID := auth.FromContext(r.Context()).UserID
+	if userID == "" {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
@@ -72,7 +62,14 @@ func GetUserURLsHandler(w http.ResponseWriter, r *http.Request, BaseURL string,
 	}
 
 	// Получение сокращенных URL пользователя из хранилища
-	urls := store.GetURLsByUserID(userID)
+	ctx, cancel := storage.ReadContext(r.Context())
+	defer cancel()
+
+	urls, err := store.GetURLsByUserID(ctx, userID)
+	if err != nil {
+		writeStorageError(w, ctx, err)
+		return
+	}
 
 	if len(urls) == 0 {
 		// Если нет сокращенных URL пользователя, возвращаем статус 204 No Content
@@ -97,93 +94,120 @@ func GetUserURLsHandler(w http.ResponseWriter, r *http.Request, BaseURL string,
 
 }
 
-func ShortenURL(w http.ResponseWriter, r *http.Request, BaseURL string, store *storage.URLStore, logger *zap.Logger) {
+func ShortenURL(w http.ResponseWriter, r *http.Request, BaseURL string, store storage.Storage, logger *zap.Logger) {
 	id := helpers.GenerateID(6)
 
-	userID := auth.GetCookieHandler(w, r)
-
-	setCookieHeader := w.Header().Get("Set-Cookie")
-	if setCookieHeader != "" {
+	userID := auth.FromContext(r.Context()).UserID
 
-		fmt.Println("Cookie set in the response:", setCookieHeader)
-		userID = r.Context().Value(UserIDKey).(string)
-		newCtx := context.WithValue(r.Context(), UserIDKey, "")
-		r = r.WithContext(newCtx)
+	body, ok := readBody(w, r)
+	if !ok {
+		return
 	}
 
-	body, err := io.ReadAll(r.Body)
+	loger.FromContext(r.Context(), logger).Debug("Request body (POST /)", zap.ByteString("body", body))
+
+	// Тело запроса целиком - сокращаемая ссылка
+	longURL, err := normalizeURL(string(body))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeValidationErrors(w, http.StatusBadRequest, fieldError("body", err))
 		return
 	}
 
-	logger.Info("Request body (POST /)" + string(body))
+	ctx, cancel := storage.WriteContext(r.Context())
+	defer cancel()
 
-	var existingID string
-	var switchBool bool
-	existingID, switchBool = store.AddURL(id, string(body), userID)
-	if existingID != "" && !switchBool {
-		existingID = strings.TrimRight(existingID, "\n")
-		shortURLout := fmt.Sprintf("%s/%s", BaseURL, existingID)
-		fmt.Println("По этому адресу уже зарегистрирован другой адрес:")
+	res, err := store.AddURL(ctx, id, longURL, userID, nil)
+	if errors.Is(err, storage.ErrURLExists) {
+		shortURLout := fmt.Sprintf("%s/%s", BaseURL, res.ID)
+		loger.FromContext(r.Context(), logger).Debug("URL already shortened", zap.String("id", res.ID))
+		newExistingLink(res, userID).setHeaders(w)
 		w.Header().Set("Content-Type", "text/plain")
 		w.WriteHeader(http.StatusConflict)
 		w.Write([]byte(shortURLout))
 		return
-	} else if existingID != "" && switchBool {
-		id = existingID
+	}
+	if err != nil {
+		writeStorageError(w, ctx, err)
+		return
 	}
 
-	shortURL := fmt.Sprintf("%s/%s", BaseURL, id)
+	shortURL := fmt.Sprintf("%s/%s", BaseURL, res.ID)
 	w.Header().Set("Content-Type", "text/plain")
 	w.WriteHeader(http.StatusCreated)
 	fmt.Fprint(w, shortURL)
 }
 
 type ShortenURLRequest struct {
-	URL string `json:"url"`
+	URL       string     `json:"url"`
+	Alias     string     `json:"alias,omitempty"`      // Необязательный пользовательский ID ссылки
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // Момент истечения срока жизни ссылки
+	TTL       string     `json:"ttl,omitempty"`        // Срок жизни ссылки, например "24h"
 }
 
-func HandleShortenURL(w http.ResponseWriter, r *http.Request, BaseURL string, store *storage.URLStore) (string, error) {
+func HandleShortenURL(w http.ResponseWriter, r *http.Request, BaseURL string, store storage.Storage) (string, error) {
 
 	var req ShortenURLRequest
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
-		http.Error(w, "Bad Request", http.StatusBadRequest)
+		writeBodyError(w, err)
 		return "", fmt.Errorf("failed to decode request body: %w", err)
 	}
 
-	userID := auth.GetCookieHandler(w, r)
+	if req.URL, err = normalizeURL(req.URL); err != nil {
+		writeValidationErrors(w, http.StatusBadRequest, fieldError("url", err))
+		return "", err
+	}
+
+	expiresAt, err := resolveExpiresAt(req.ExpiresAt, req.TTL, time.Now())
+	if err != nil {
+		writeValidationErrors(w, http.StatusBadRequest, fieldError("expires_at", err))
+		return "", err
+	}
+
+	userID := auth.FromContext(r.Context()).UserID
 
 	// Используем тело запроса
 	id := helpers.GenerateID(6)
 
-	var existingID string
-	var switchBool bool
-	existingID, switchBool = store.AddURL(id, req.URL, userID)
-	if existingID != "" && !switchBool {
-		fmt.Println("По этому адресу уже зарегистрирован другой адрес:", existingID)
+	ctx, cancel := storage.WriteContext(r.Context())
+	defer cancel()
 
-		response := struct {
-			Result string `json:"result"`
-		}{
-			Result: existingID,
+	var res storage.AddResult
+	if req.Alias != "" {
+		if err = validateAlias(req.Alias); err != nil {
+			writeValidationErrors(w, http.StatusBadRequest, fieldError("alias", err))
+			return "", err
+		}
+
+		res, err = store.AddURLWithAlias(ctx, req.Alias, req.URL, userID, expiresAt)
+		if errors.Is(err, storage.ErrAliasExists) {
+			http.Error(w, "Alias already exists", http.StatusConflict)
+			return "", err
+		}
+	} else {
+		res, err = store.AddURL(ctx, id, req.URL, userID, expiresAt)
+	}
+	if errors.Is(err, storage.ErrURLExists) {
+		// Как и при успехе, возвращаем полную короткую ссылку, а не только ее ID
+		response := shortenConflict{
+			Result:       fmt.Sprintf("%s/%s", BaseURL, res.ID),
+			existingLink: newExistingLink(res, userID),
 		}
 
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusConflict)
 
-		err = json.NewEncoder(w).Encode(response)
-		if err != nil {
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			return "", fmt.Errorf("failed to encode response: %w", err)
+		if encodeErr := json.NewEncoder(w).Encode(response); encodeErr != nil {
+			return "", fmt.Errorf("failed to encode response: %w", encodeErr)
 		}
-		return "", fmt.Errorf("failed to save URL to database")
-	} else if existingID != "" && switchBool {
-		id = existingID
+		return "", err
+	}
+	if err != nil {
+		writeStorageError(w, ctx, err)
+		return "", fmt.Errorf("failed to save URL: %w", err)
 	}
 
-	shortURL := fmt.Sprintf("%s/%s", BaseURL, id)
+	shortURL := fmt.Sprintf("%s/%s", BaseURL, res.ID)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 
@@ -202,42 +226,145 @@ func HandleShortenURL(w http.ResponseWriter, r *http.Request, BaseURL string, st
 	return shortURL, nil
 }
 
-func RedirectURL(w http.ResponseWriter, r *http.Request, store *storage.URLStore) {
+func RedirectURL(w http.ResponseWriter, r *http.Request, store storage.Storage, clicks *analytics.Recorder) {
 	id := chi.URLParam(r, "id")
-	url, ok := store.GetURL(id)
-	if url == "" && !ok {
-		http.Error(w, "Invalid URL", http.StatusBadRequest)
-		return
-	} else if !ok {
-		w.WriteHeader(http.StatusGone)
+
+	ctx, cancel := storage.ReadContext(r.Context())
+	defer cancel()
+
+	url, err := store.GetURL(ctx, id)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		metrics.ObserveRedirect(metrics.RedirectMiss)
+	case errors.Is(err, storage.ErrDeleted):
+		metrics.ObserveRedirect(metrics.RedirectGone)
+	case err == nil:
+		metrics.ObserveRedirect(metrics.RedirectHit)
+	}
+	if err != nil {
+		writeStorageError(w, ctx, err)
 		return
 	}
 
 	http.Redirect(w, r, url, http.StatusTemporaryRedirect)
+
+	// Переход ставится в очередь без ожидания записи
+	if clicks != nil {
+		clicks.Record(newClick(r, id, clicks.HashIP))
+	}
 }
 
-func HandleShortenBatch(w http.ResponseWriter, r *http.Request, BaseURL string, store *storage.URLStore) {
+// newClick - функция для сбора данных о переходе из запроса, адрес клиента сохраняется только хешем hashIP
+func newClick(r *http.Request, id string, hashIP func(string) string) analytics.Click {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
 
-	ctx := r.Context()
+	return analytics.Click{
+		ShortID:   id,
+		Time:      time.Now(),
+		Referrer:  r.Referer(),
+		UserAgent: r.UserAgent(),
+		IPHash:    hashIP(ip),
+	}
+}
 
-	userID := auth.GetCookieHandler(w, r)
+func GetURLStatsHandler(w http.ResponseWriter, r *http.Request, BaseURL string, store storage.Storage, clicks *analytics.Recorder, logger *zap.Logger) {
+	// Получение идентификатора пользователя из контекста запроса
+	userID := auth.FromContext(r.Context()).UserID
+	if userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Статистика доступна только владельцу ссылки, в том числе после ее удаления или истечения срока:
+	// история переходов сохраняется вместе с записью о ссылке
+	id := chi.URLParam(r, "id")
+
+	ctx, cancel := storage.ReadContext(r.Context())
+	defer cancel()
+
+	owner, err := store.GetURLOwner(ctx, id)
+	if err != nil {
+		writeStorageError(w, ctx, err)
+		return
+	}
+	if owner != userID {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+
+	stats, err := clicks.Stats(ctx, id)
+	if err != nil {
+		writeStorageError(w, ctx, err)
+		return
+	}
+
+	response := struct {
+		ShortURL string `json:"short_url"`
+		analytics.Stats
+	}{
+		ShortURL: BaseURL + "/" + id,
+		Stats:    stats,
+	}
+
+	// Отправка ответа в формате JSON
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func HandleShortenBatch(w http.ResponseWriter, r *http.Request, BaseURL string, store storage.Storage) {
+	userID := auth.FromContext(r.Context()).UserID
 
 	var records []map[string]string
 	err := json.NewDecoder(r.Body).Decode(&records)
 	if err != nil {
-		http.Error(w, "Bad Request", http.StatusBadRequest)
+		writeBodyError(w, err)
 		return
 	}
 
 	// Проверяем, что есть записи для обработки
 	if len(records) == 0 {
-		http.Error(w, "Empty batch", http.StatusBadRequest)
+		writeValidationErrors(w, http.StatusBadRequest, FieldError{Field: "body", Message: "batch is empty"})
 		return
 	}
 
-	res, _ := store.AddURLwithTx(records, ctx, BaseURL, userID)
-	if res == nil {
-		http.Error(w, "StatusBadRequest", http.StatusBadRequest)
+	// Проверяем все записи, чтобы вернуть клиенту сразу все ошибки. correlation_id
+	// становится ID короткой ссылки, поэтому проверяется как псевдоним. Срок жизни
+	// каждой записи передаем в хранилище в поле expires_at
+	now := time.Now()
+	var errs []FieldError
+	for i, record := range records {
+		if err := validateAlias(record["correlation_id"]); err != nil {
+			errs = append(errs, itemError(i, "correlation_id", err))
+		}
+		longURL, err := normalizeURL(record["original_url"])
+		if err != nil {
+			errs = append(errs, itemError(i, "original_url", err))
+		} else {
+			record["original_url"] = longURL
+		}
+		if err = resolveRecordExpiresAt(record, now); err != nil {
+			errs = append(errs, itemError(i, "expires_at", err))
+		}
+	}
+	if len(errs) > 0 {
+		writeValidationErrors(w, http.StatusBadRequest, errs...)
+		return
+	}
+
+	ctx, cancel := storage.WriteContext(r.Context())
+	defer cancel()
+
+	res, err := store.AddURLwithTx(ctx, records, BaseURL, userID)
+	var conflictErr *storage.BatchConflictError
+	if errors.As(err, &conflictErr) {
+		writeBatchConflict(w, BaseURL, userID, conflictErr)
+		return
+	}
+	if err != nil {
+		writeStorageError(w, ctx, err)
 		return
 	}
 	// Отправляем ответ
@@ -245,3 +372,58 @@ func HandleShortenBatch(w http.ResponseWriter, r *http.Request, BaseURL string,
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(res)
 }
+
+// IssueTokenHandler выдает Bearer-токен для текущего пользователя
+func IssueTokenHandler(w http.ResponseWriter, r *http.Request, keys *auth.KeySet, logger *zap.Logger) {
+	userID := auth.FromContext(r.Context()).UserID
+	if userID == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	token, expiresAt, err := keys.Sign(userID, time.Now())
+	if err != nil {
+		loger.FromContext(r.Context(), logger).Error("Error signing token", zap.Error(err))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	response := struct {
+		Token     string    `json:"token"`
+		TokenType string    `json:"token_type"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}{
+		Token:     token,
+		TokenType: "Bearer",
+		ExpiresAt: expiresAt,
+	}
+
+	// Отправка ответа в формате JSON
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(response)
+}
+
+// PingHandler проверяет доступность активного хранилища: 200, если оно отвечает, иначе 503
+func PingHandler(w http.ResponseWriter, r *http.Request, store storage.Storage, backend string, logger *zap.Logger) {
+	response := struct {
+		Backend string `json:"backend"`
+		Status  string `json:"status"`
+	}{
+		Backend: backend,
+		Status:  "ok",
+	}
+
+	status := http.StatusOK
+	if err := store.Ping(r.Context()); err != nil {
+		loger.FromContext(r.Context(), logger).Error("Storage is unavailable", zap.String("backend", backend), zap.Error(err))
+		response.Status = "unavailable"
+		status = http.StatusServiceUnavailable
+	}
+
+	// Отправка ответа в формате JSON
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
@@ -2,32 +2,32 @@ package handlers_test
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"github.com/egosha7/shortlink/internal/analytics"
+	"github.com/egosha7/shortlink/internal/auth"
 	"github.com/egosha7/shortlink/internal/config"
 	"github.com/egosha7/shortlink/internal/loger"
 	"github.com/egosha7/shortlink/internal/storage"
-	"github.com/jackc/pgx/v4"
-	"github.com/jackc/pgx/v4/pgxpool"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/egosha7/shortlink/internal/handlers"
 	"github.com/go-chi/chi"
+	"go.uber.org/zap"
 )
 
 func TestShortenURL(t *testing.T) {
 	cfg := &config.Config{
 		Addr:     "localhost:8080",
 		BaseURL:  "http://localhost:8080",
-		FilePath: "tmp\\some3.json",
+		FilePath: filepath.Join(t.TempDir(), "some3.json"),
 		DataBase: "",
 	}
-	conn := &pgx.Conn{}
-	pool := &pgxpool.Pool{}
-
 	logger, err := loger.SetupLogger()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error creating logger: %v\n", err)
@@ -35,7 +35,11 @@ func TestShortenURL(t *testing.T) {
 	}
 
 	// Указываем экземпляр URLStore
-	store := storage.NewURLStore(cfg.FilePath, cfg.DataBase, conn, logger, pool)
+	store := storage.NewFileStore(cfg.FilePath, logger)
+	if err := store.LoadFromFile(); err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
 
 	// Создаем тестовый запрос
 	body := []byte("http://example.com")
@@ -82,13 +86,10 @@ func TestRedirectURL(t *testing.T) {
 	cfg := &config.Config{
 		Addr:     "localhost:8080",
 		BaseURL:  "http://localhost:8080",
-		FilePath: "tmp\\some3.json",
+		FilePath: filepath.Join(t.TempDir(), "some3.json"),
 		DataBase: "",
 	}
 
-	pool := &pgxpool.Pool{}
-	conn := &pgx.Conn{}
-
 	logger, err := loger.SetupLogger()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error creating logger: %v\n", err)
@@ -96,7 +97,11 @@ func TestRedirectURL(t *testing.T) {
 	}
 
 	// Указываем экземпляр URLStore
-	store := storage.NewURLStore(cfg.FilePath, cfg.DataBase, conn, logger, pool)
+	store := storage.NewFileStore(cfg.FilePath, logger)
+	if err := store.LoadFromFile(); err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
 
 	link := "http://example.com"
 	formData := strings.NewReader(link)
@@ -143,7 +148,7 @@ func TestRedirectURL(t *testing.T) {
 	// Регистрируем обработчик для GET-запросов на маршруте /{id}
 	r2.Get(
 		"/{id}", func(w http.ResponseWriter, r *http.Request) {
-			handlers.RedirectURL(w, r, store)
+			handlers.RedirectURL(w, r, store, nil)
 		},
 	)
 
@@ -166,3 +171,224 @@ func TestRedirectURL(t *testing.T) {
 		)
 	}
 }
+
+func TestHandleShortenBatch(t *testing.T) {
+	cfg := &config.Config{
+		Addr:    "localhost:8080",
+		BaseURL: "http://localhost:8080",
+	}
+
+	logger, err := loger.SetupLogger()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating logger: %v\n", err)
+		os.Exit(1)
+	}
+
+	store := storage.NewMemoryStore(logger)
+
+	// Создаем маршрутизатор chi
+	r := chi.NewRouter()
+
+	// Регистрируем обработчик
+	r.Post(
+		"/api/shorten/batch", func(w http.ResponseWriter, r *http.Request) {
+			handlers.HandleShortenBatch(w, r, cfg.BaseURL, store)
+		},
+	)
+
+	body := `[{"correlation_id":"item-a1","original_url":"http://a.example.com"},{"correlation_id":"item-b2","original_url":"http://b.example.com"}]`
+	req, err := http.NewRequest("POST", "/api/shorten/batch", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	// Проверяем код ответа
+	if status := rr.Code; status != http.StatusCreated {
+		t.Errorf(
+			"handler returned wrong status code: got %v want %v",
+			status, http.StatusCreated,
+		)
+	}
+
+	expected := `"short_url":"http://localhost:8080/item-b2"`
+	if !strings.Contains(rr.Body.String(), expected) {
+		t.Errorf(
+			"handler returned unexpected body: got %v want %v",
+			rr.Body.String(), expected,
+		)
+	}
+
+	// Пакет с уже сохраненным URL отклоняется целиком
+	body = `[{"correlation_id":"item-c3","original_url":"http://c.example.com"},{"correlation_id":"item-d4","original_url":"http://a.example.com"}]`
+	req, err = http.NewRequest("POST", "/api/shorten/batch", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusConflict {
+		t.Errorf(
+			"handler returned wrong status code: got %v want %v",
+			status, http.StatusConflict,
+		)
+	}
+
+	if _, err := store.GetURL(context.Background(), "item-c3"); err == nil {
+		t.Errorf("rejected batch was partially saved")
+	}
+}
+
+func TestRedirectDeletedURL(t *testing.T) {
+	logger, err := loger.SetupLogger()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating logger: %v\n", err)
+		os.Exit(1)
+	}
+
+	store := storage.NewMemoryStore(logger)
+	res, _ := store.AddURL(context.Background(), "abc123", "http://example.com", "user1", nil)
+	id := res.ID
+
+	// Чужой пользователь не может удалить ссылку
+	store.DeleteURLs(context.Background(), []string{id}, "user2")
+	if _, err := store.GetURL(context.Background(), id); err != nil {
+		t.Fatalf("URL deleted by another user")
+	}
+
+	store.DeleteURLs(context.Background(), []string{id}, "user1")
+
+	// Создаем маршрутизатор chi
+	r := chi.NewRouter()
+
+	// Регистрируем обработчик для GET-запросов на маршруте /{id}
+	r.Get(
+		"/{id}", func(w http.ResponseWriter, r *http.Request) {
+			handlers.RedirectURL(w, r, store, nil)
+		},
+	)
+
+	req, err := http.NewRequest("GET", "/"+id, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	// Проверяем код ответа
+	if status := rr.Code; status != http.StatusGone {
+		t.Errorf(
+			"handler returned wrong status code: got %v want %v",
+			status, http.StatusGone,
+		)
+	}
+
+	if urls, _ := store.GetURLsByUserID(context.Background(), "user1"); len(urls) != 0 {
+		t.Errorf("deleted URL returned for user: %v", urls)
+	}
+}
+
+func TestHandleShortenURLAlias(t *testing.T) {
+	cfg := &config.Config{
+		Addr:    "localhost:8080",
+		BaseURL: "http://localhost:8080",
+	}
+
+	logger, err := loger.SetupLogger()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating logger: %v\n", err)
+		os.Exit(1)
+	}
+
+	store := storage.NewMemoryStore(logger)
+
+	// Создаем маршрутизатор chi
+	r := chi.NewRouter()
+
+	// Регистрируем обработчик
+	r.Post(
+		"/api/shorten", func(w http.ResponseWriter, r *http.Request) {
+			handlers.HandleShortenURL(w, r, cfg.BaseURL, store)
+		},
+	)
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"new alias", `{"url":"http://example.com/sale","alias":"spring-sale"}`, http.StatusCreated},
+		{"taken alias", `{"url":"http://example.com/other","alias":"spring-sale"}`, http.StatusConflict},
+		{"reserved alias", `{"url":"http://example.com/other","alias":"API"}`, http.StatusBadRequest},
+		{"metrics alias", `{"url":"http://example.com/other","alias":"metrics"}`, http.StatusBadRequest},
+		{"invalid alias", `{"url":"http://example.com/other","alias":"a/b"}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				req, err := http.NewRequest("POST", "/api/shorten", strings.NewReader(tt.body))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				rr := httptest.NewRecorder()
+				r.ServeHTTP(rr, req)
+
+				// Проверяем код ответа
+				if status := rr.Code; status != tt.status {
+					t.Errorf(
+						"handler returned wrong status code: got %v want %v",
+						status, tt.status,
+					)
+				}
+			},
+		)
+	}
+
+	if url, err := store.GetURL(context.Background(), "spring-sale"); err != nil || url != "http://example.com/sale" {
+		t.Errorf("alias resolved to %q, %v", url, err)
+	}
+}
+
+func TestGetURLStats(t *testing.T) {
+	store := storage.NewMemoryStore(zap.NewNop())
+	store.AddURL(context.Background(), "abc123", "http://example.com", "user1", nil)
+	store.DeleteURLs(context.Background(), []string{"abc123"}, "user1")
+
+	clicks := analytics.NewRecorder(analytics.NewMemorySink(), []byte("key"), zap.NewNop())
+	defer clicks.Stop(context.Background())
+
+	r := chi.NewRouter()
+	r.Get(
+		"/api/user/urls/{id}/stats", func(w http.ResponseWriter, r *http.Request) {
+			handlers.GetURLStatsHandler(w, r, "http://localhost:8080", store, clicks, zap.NewNop())
+		},
+	)
+
+	// Владелец видит статистику и удаленной ссылки, остальным она не видна
+	tests := []struct {
+		userID string
+		id     string
+		want   int
+	}{
+		{"user1", "abc123", http.StatusOK},
+		{"user2", "abc123", http.StatusNotFound},
+		{"user1", "missing", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		ctx := auth.WithIdentity(context.Background(), auth.Identity{UserID: tt.userID})
+		req := httptest.NewRequest(http.MethodGet, "/api/user/urls/"+tt.id+"/stats", nil).WithContext(ctx)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+
+		if rr.Code != tt.want {
+			t.Errorf("stats of %s as %s: got %d, want %d", tt.id, tt.userID, rr.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"github.com/egosha7/shortlink/internal/loger"
+	"github.com/egosha7/shortlink/internal/storage"
+	"net/http"
+)
+
+// StorageTimeouts - middleware, задающий предельное время операций обработчиков с хранилищем
+func StorageTimeouts(t storage.Timeouts) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				next.ServeHTTP(w, r.WithContext(storage.WithTimeouts(r.Context(), t)))
+			},
+		)
+	}
+}
+
+// writeStorageError отвечает клиенту кодом, соответствующим ошибке хранилища: 404, 410, 409,
+// 504 при истечении времени операции, 503 при отмене запроса или недоступности хранилища.
+// Причина ошибок сервера попадает в лог завершения запроса
+func writeStorageError(w http.ResponseWriter, ctx context.Context, err error) {
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	case errors.Is(err, storage.ErrDeleted):
+		http.Error(w, "Gone", http.StatusGone)
+		return
+	case errors.Is(err, storage.ErrConflict):
+		http.Error(w, "Conflict", http.StatusConflict)
+		return
+	}
+
+	loger.SetError(ctx, err)
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded):
+		http.Error(w, "Gateway Timeout", http.StatusGatewayTimeout)
+	case errors.Is(err, context.Canceled) || errors.Is(err, storage.ErrUnavailable):
+		// Клиенту стоит повторить запрос позже
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+	default:
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/egosha7/shortlink/internal/storage"
+	"github.com/go-chi/chi"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// slowStore отвечает только по истечении контекста операции, как зависшая БД
+type slowStore struct {
+	storage.Storage
+}
+
+func (s slowStore) GetURL(ctx context.Context, id string) (string, error) {
+	<-ctx.Done()
+	return "", ctx.Err()
+}
+
+func TestRedirectURLTimeout(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(StorageTimeouts(storage.Timeouts{Read: 10 * time.Millisecond}))
+	r.Get(
+		"/{id}", func(w http.ResponseWriter, r *http.Request) {
+			RedirectURL(w, r, slowStore{}, nil)
+		},
+	)
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/abc123", nil))
+
+	// Истекшее время операции не должно превращаться в 400 Invalid URL
+	if rr.Code != http.StatusGatewayTimeout {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusGatewayTimeout)
+	}
+}
+
+// failingStore возвращает заданную ошибку при поиске ссылки
+type failingStore struct {
+	storage.Storage
+	err error
+}
+
+func (s failingStore) GetURL(ctx context.Context, id string) (string, error) {
+	return "", s.err
+}
+
+func TestRedirectURLStorageErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+	}{
+		{"not found", storage.ErrNotFound, http.StatusNotFound},
+		{"deleted", storage.ErrDeleted, http.StatusGone},
+		{"unavailable", fmt.Errorf("%w: connection refused", storage.ErrUnavailable), http.StatusServiceUnavailable},
+		{"unknown", errors.New("unexpected"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				r := chi.NewRouter()
+				r.Get(
+					"/{id}", func(w http.ResponseWriter, r *http.Request) {
+						RedirectURL(w, r, failingStore{err: tt.err}, nil)
+					},
+				)
+
+				rr := httptest.NewRecorder()
+				r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/abc123", nil))
+
+				if rr.Code != tt.status {
+					t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tt.status)
+				}
+			},
+		)
+	}
+}
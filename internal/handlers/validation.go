@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// Максимальная длина сокращаемой ссылки после нормализации
+const maxURLLength = 2048
+
+// Схемы ссылок, которые разрешено сокращать
+var allowedSchemes = map[string]struct{}{
+	"http":  {},
+	"https": {},
+}
+
+// FieldError - ошибка проверки одного поля запроса, Index указывает на запись пакета
+type FieldError struct {
+	Index   *int   `json:"index,omitempty"`
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	if e.Index != nil {
+		return fmt.Sprintf("record %d: %s: %s", *e.Index, e.Field, e.Message)
+	}
+	return e.Field + ": " + e.Message
+}
+
+// fieldError - функция для создания ошибки поля из err
+func fieldError(field string, err error) FieldError {
+	return FieldError{Field: field, Message: err.Error()}
+}
+
+// itemError - функция для создания ошибки поля записи пакета с номером index
+func itemError(index int, field string, err error) FieldError {
+	return FieldError{Index: &index, Field: field, Message: err.Error()}
+}
+
+// writeValidationErrors отвечает списком ошибок проверки в формате JSON
+func writeValidationErrors(w http.ResponseWriter, status int, errs ...FieldError) {
+	response := struct {
+		Errors []FieldError `json:"errors"`
+	}{
+		Errors: errs,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// writeBodyError отвечает на ошибку чтения или разбора тела запроса: 413 при превышении
+// предельного размера, иначе 400
+func writeBodyError(w http.ResponseWriter, err error) {
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		writeValidationErrors(
+			w, http.StatusRequestEntityTooLarge,
+			FieldError{Field: "body", Message: fmt.Sprintf("request body exceeds %d bytes", maxErr.Limit)},
+		)
+		return
+	}
+	writeValidationErrors(w, http.StatusBadRequest, FieldError{Field: "body", Message: "malformed request body"})
+}
+
+// readBody - функция для чтения тела запроса с учетом предельного размера
+func readBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeBodyError(w, err)
+		return nil, false
+	}
+	return body, true
+}
+
+// MaxBodySize ограничивает размер тела запроса, превышение обработчики возвращают как 413
+func MaxBodySize(n int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				r.Body = http.MaxBytesReader(w, r.Body, n)
+				next.ServeHTTP(w, r)
+			},
+		)
+	}
+}
+
+// normalizeURL - функция для проверки и нормализации сокращаемой ссылки: обрезает пробелы,
+// допускает только схемы http и https и переводит международные домены в punycode
+func normalizeURL(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", errors.New("url is required")
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", errors.New("url is malformed")
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	if _, ok := allowedSchemes[u.Scheme]; !ok {
+		return "", errors.New("url scheme must be http or https")
+	}
+	if u.Opaque != "" || u.Host == "" {
+		return "", errors.New("url must have a host")
+	}
+
+	host, port := u.Hostname(), u.Port()
+	if net.ParseIP(host) == nil {
+		host, err = idna.Lookup.ToASCII(host)
+		if err != nil {
+			return "", fmt.Errorf("url host is invalid: %w", err)
+		}
+	}
+	switch {
+	case port != "":
+		u.Host = net.JoinHostPort(host, port)
+	case strings.Contains(host, ":"):
+		// IPv6-адрес записывается в квадратных скобках
+		u.Host = "[" + host + "]"
+	default:
+		u.Host = host
+	}
+
+	normalized := u.String()
+	if len(normalized) > maxURLLength {
+		return "", fmt.Errorf("url must not be longer than %d characters", maxURLLength)
+	}
+	return normalized, nil
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/egosha7/shortlink/internal/storage"
+	"go.uber.org/zap"
+)
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    string
+		wantErr bool
+	}{
+		{"  http://example.com/path \n", "http://example.com/path", false},
+		{"HTTPS://example.com", "https://example.com", false},
+		{"http://пример.рф/страница", "http://xn--e1afmkfd.xn--p1ai/%D1%81%D1%82%D1%80%D0%B0%D0%BD%D0%B8%D1%86%D0%B0", false},
+		{"http://[::1]:8080/", "http://[::1]:8080/", false},
+		{"", "", true},
+		{"   ", "", true},
+		{"javascript:alert(1)", "", true},
+		{"ftp://example.com/file", "", true},
+		{"example.com", "", true},
+		{"http://", "", true},
+		{"http://example.com/" + strings.Repeat("a", maxURLLength), "", true},
+	}
+	for _, tt := range tests {
+		got, err := normalizeURL(tt.raw)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("normalizeURL(%q) = %q, %v; want %q, error %v", tt.raw, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestHandleShortenBatchValidation(t *testing.T) {
+	store := storage.NewMemoryStore(zap.NewNop())
+
+	body := `[{"correlation_id":"item-a1","original_url":"http://a.example.com"},` +
+		`{"correlation_id":"item-b2","original_url":"javascript:alert(1)"},` +
+		`{"correlation_id":"item-c3","original_url":"http://c.example.com","ttl":"-1h"}]`
+	req := httptest.NewRequest(http.MethodPost, "/api/shorten/batch", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	HandleShortenBatch(rr, req, "http://localhost:8080", store)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+
+	var response struct {
+		Errors []FieldError `json:"errors"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Errors) != 2 ||
+		*response.Errors[0].Index != 1 || response.Errors[0].Field != "original_url" ||
+		*response.Errors[1].Index != 2 || response.Errors[1].Field != "expires_at" {
+		t.Errorf("unexpected validation errors: %+v", response.Errors)
+	}
+
+	// Ни одна запись невалидного пакета не должна сохраниться
+	if _, err := store.GetURL(context.Background(), "item-a1"); err == nil {
+		t.Errorf("record from invalid batch was saved")
+	}
+}
+
+func TestHandleShortenBatchCorrelationID(t *testing.T) {
+	store := storage.NewMemoryStore(zap.NewNop())
+
+	// correlation_id становится путем короткой ссылки, недостижимые пути отклоняются
+	body := `[{"correlation_id":"","original_url":"http://a.example.com"},` +
+		`{"correlation_id":"a/b","original_url":"http://b.example.com"},` +
+		`{"correlation_id":"ping","original_url":"http://c.example.com"},` +
+		`{"correlation_id":"item-d4","original_url":"http://d.example.com"}]`
+	req := httptest.NewRequest(http.MethodPost, "/api/shorten/batch", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	HandleShortenBatch(rr, req, "http://localhost:8080", store)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+
+	var response struct {
+		Errors []FieldError `json:"errors"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Errors) != 3 {
+		t.Fatalf("unexpected validation errors: %+v", response.Errors)
+	}
+	for i, e := range response.Errors {
+		if *e.Index != i || e.Field != "correlation_id" {
+			t.Errorf("unexpected validation error: %+v", e)
+		}
+	}
+}
+
+func TestMaxBodySize(t *testing.T) {
+	store := storage.NewMemoryStore(zap.NewNop())
+
+	handler := MaxBodySize(32)(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				ShortenURL(w, r, "http://localhost:8080", store, zap.NewNop())
+			},
+		),
+	)
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("http://example.com/"+strings.Repeat("a", 64)))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusRequestEntityTooLarge)
+	}
+}
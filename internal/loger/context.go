@@ -0,0 +1,77 @@
+package loger
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+// RequestIDHeader - заголовок с ID запроса, входящий ID сохраняется для сквозной трассировки
+const RequestIDHeader = "X-Request-ID"
+
+// Максимальная длина принимаемого от клиента ID запроса
+const maxRequestIDLength = 128
+
+type contextKey struct{}
+
+// requestInfo - данные запроса, которые заполняются по мере его обработки
+type requestInfo struct {
+	id     string
+	userID string
+	err    error
+}
+
+func withRequestInfo(ctx context.Context, info *requestInfo) context.Context {
+	return context.WithValue(ctx, contextKey{}, info)
+}
+
+func requestInfoFromContext(ctx context.Context) *requestInfo {
+	info, _ := ctx.Value(contextKey{}).(*requestInfo)
+	return info
+}
+
+// RequestID возвращает ID запроса из контекста или пустую строку
+func RequestID(ctx context.Context) string {
+	if info := requestInfoFromContext(ctx); info != nil {
+		return info.id
+	}
+	return ""
+}
+
+// SetUserID запоминает пользователя запроса для записи в лог его завершения
+func SetUserID(ctx context.Context, userID string) {
+	if info := requestInfoFromContext(ctx); info != nil {
+		info.userID = userID
+	}
+}
+
+// SetError запоминает причину ошибки запроса для записи в лог его завершения
+func SetError(ctx context.Context, err error) {
+	if info := requestInfoFromContext(ctx); info != nil {
+		info.err = err
+	}
+}
+
+// FromContext возвращает логгер, дополненный ID запроса из контекста
+func FromContext(ctx context.Context, logger *zap.Logger) *zap.Logger {
+	if id := RequestID(ctx); id != "" {
+		return logger.With(zap.String("request_id", id))
+	}
+	return logger
+}
+
+// requestIDFromHeader возвращает ID из заголовка запроса или генерирует новый,
+// если заголовка нет или значение не похоже на ID
+func requestIDFromHeader(r *http.Request) string {
+	id := r.Header.Get(RequestIDHeader)
+	if id == "" || len(id) > maxRequestIDLength {
+		return uuid.NewString()
+	}
+	for _, c := range id {
+		if c < 0x21 || c > 0x7e {
+			return uuid.NewString()
+		}
+	}
+	return id
+}
@@ -8,20 +8,42 @@ import (
 	"time"
 )
 
+// SetupLogger - функция для создания логгера по умолчанию, используется до чтения конфигурации
 func SetupLogger() (*zap.Logger, error) {
+	return NewLogger("info", "console")
+}
+
+// NewLogger - функция для создания логгера с уровнем level и кодировкой encoding: json или console
+func NewLogger(level string, encoding string) (*zap.Logger, error) {
+	atomicLevel, err := zap.ParseAtomicLevel(level)
+	if err != nil {
+		return nil, fmt.Errorf("invalid log level: %v", err)
+	}
+
+	encoderConfig := zapcore.EncoderConfig{
+		MessageKey:     "message",
+		LevelKey:       "level",
+		TimeKey:        "time",
+		EncodeLevel:    zapcore.CapitalLevelEncoder,
+		EncodeTime:     zapcore.ISO8601TimeEncoder,
+		EncodeDuration: zapcore.StringDurationEncoder,
+	}
+	switch encoding {
+	case "console":
+	case "json":
+		// В JSON длительности пишутся числом секунд, чтобы их можно было агрегировать
+		encoderConfig.EncodeLevel = zapcore.LowercaseLevelEncoder
+		encoderConfig.EncodeDuration = zapcore.SecondsDurationEncoder
+	default:
+		return nil, fmt.Errorf("invalid log encoding %q", encoding)
+	}
+
 	loggerConfig := zap.Config{
-		Encoding:         "console",
-		Level:            zap.NewAtomicLevelAt(zapcore.InfoLevel),
+		Encoding:         encoding,
+		Level:            atomicLevel,
 		OutputPaths:      []string{"stdout"},
 		ErrorOutputPaths: []string{"stderr"},
-		EncoderConfig: zapcore.EncoderConfig{
-			MessageKey:     "message",
-			LevelKey:       "level",
-			TimeKey:        "time",
-			EncodeLevel:    zapcore.CapitalLevelEncoder,
-			EncodeTime:     zapcore.ISO8601TimeEncoder,
-			EncodeDuration: zapcore.StringDurationEncoder,
-		},
+		EncoderConfig:    encoderConfig,
 	}
 
 	logger, err := loggerConfig.Build()
@@ -32,27 +54,43 @@ func SetupLogger() (*zap.Logger, error) {
 	return logger, nil
 }
 
+// LogMiddleware присваивает запросу ID и пишет в лог его начало и завершение
 func LogMiddleware(logger *zap.Logger, next http.Handler) http.Handler {
 	return http.HandlerFunc(
 		func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
-			duration := time.Since(start)
-			logger.Info(
+
+			requestID := requestIDFromHeader(r)
+			w.Header().Set(RequestIDHeader, requestID)
+
+			info := &requestInfo{id: requestID}
+			r = r.WithContext(withRequestInfo(r.Context(), info))
+
+			reqLogger := logger.With(zap.String("request_id", requestID))
+			reqLogger.Info(
 				"Request received",
-				zap.String("URI", r.RequestURI),
-				zap.String("Method", r.Method),
-				zap.Duration("Duration", duration),
+				zap.String("uri", r.RequestURI),
+				zap.String("method", r.Method),
 			)
 
 			rw := newResponseWriter(w)
 			next.ServeHTTP(rw, r)
 
-			logger.Info(
-				"Request completed",
-				zap.Int("Status", rw.Status()),
-				zap.Int("Size", rw.Size()),
-				zap.Duration("Duration", duration),
-			)
+			fields := []zap.Field{
+				zap.String("uri", r.RequestURI),
+				zap.String("method", r.Method),
+				zap.Int("status", rw.Status()),
+				zap.Int("size", rw.Size()),
+				zap.Duration("duration", time.Since(start)),
+				zap.String("user_id", info.userID),
+			}
+
+			// Запрос, завершенный ошибкой сервера, пишется с уровнем error и причиной
+			if info.err != nil {
+				reqLogger.Error("Request completed", append(fields, zap.Error(info.err))...)
+				return
+			}
+			reqLogger.Info("Request completed", fields...)
 		},
 	)
 }
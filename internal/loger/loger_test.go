@@ -0,0 +1,55 @@
+package loger
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestLogMiddleware(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+
+	handler := LogMiddleware(
+		zap.New(core), http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				SetUserID(r.Context(), "user1")
+				time.Sleep(10 * time.Millisecond)
+				w.WriteHeader(http.StatusCreated)
+			},
+		),
+	)
+
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Header.Set(RequestIDHeader, "req-1")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if id := rec.Header().Get(RequestIDHeader); id != "req-1" {
+		t.Errorf("incoming request ID not preserved: %q", id)
+	}
+
+	completed := logs.FilterMessage("Request completed").All()
+	if len(completed) != 1 {
+		t.Fatalf("expected one completion log, got %d", len(completed))
+	}
+	fields := completed[0].ContextMap()
+	if fields["request_id"] != "req-1" || fields["user_id"] != "user1" || fields["status"] != int64(http.StatusCreated) {
+		t.Errorf("unexpected completion fields: %v", fields)
+	}
+	if d, _ := fields["duration"].(time.Duration); d < 10*time.Millisecond {
+		t.Errorf("duration measured before handler: %v", d)
+	}
+}
+
+func TestRequestIDGenerated(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(RequestIDHeader, "bad id\n")
+
+	if id := requestIDFromHeader(req); id == "" || id == "bad id\n" {
+		t.Errorf("invalid request ID accepted: %q", id)
+	}
+}
@@ -0,0 +1,128 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "shortlink"
+
+// Результаты перехода по короткой ссылке
+const (
+	RedirectHit  = "hit"  // Ссылка найдена, выполнено перенаправление
+	RedirectMiss = "miss" // Ссылка не существует
+	RedirectGone = "gone" // Ссылка удалена или истек срок ее жизни
+)
+
+var (
+	requests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "Количество HTTP-запросов по маршрутам и статусам ответа.",
+		}, []string{"method", "route", "status"},
+	)
+
+	requestDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Время обработки HTTP-запросов по маршрутам и статусам ответа.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"},
+	)
+
+	redirects = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "redirects_total",
+			Help:      "Количество переходов по коротким ссылкам по результату: hit, miss, gone.",
+		}, []string{"result"},
+	)
+
+	storageDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "storage_operation_duration_seconds",
+			Help:      "Время выполнения операций хранилища ссылок.",
+			Buckets:   []float64{.0001, .0005, .001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		}, []string{"backend", "operation"},
+	)
+)
+
+// Handler возвращает обработчик, отдающий метрики в формате Prometheus
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// Middleware считает запросы и время их обработки. Маршрут берется из шаблона chi,
+// чтобы ID ссылок не порождали отдельные серии, поэтому middleware подключается к корневому роутеру
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+			next.ServeHTTP(ww, r)
+
+			route := "unmatched"
+			if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+				route = rctx.RoutePattern()
+			}
+			status := ww.Status()
+			if status == 0 {
+				// Обработчик ничего не записал, net/http отвечает 200
+				status = http.StatusOK
+			}
+
+			labels := prometheus.Labels{"method": r.Method, "route": route, "status": strconv.Itoa(status)}
+			requests.With(labels).Inc()
+			requestDuration.With(labels).Observe(time.Since(start).Seconds())
+		},
+	)
+}
+
+// ObserveRedirect учитывает переход по короткой ссылке с результатом RedirectHit, RedirectMiss или RedirectGone
+func ObserveRedirect(result string) {
+	redirects.WithLabelValues(result).Inc()
+}
+
+// ObserveStorage учитывает время операции хранилища, начатой в start
+func ObserveStorage(backend, operation string, start time.Time) {
+	storageDuration.WithLabelValues(backend, operation).Observe(time.Since(start).Seconds())
+}
+
+// Источник глубины очереди удаления, метрика регистрируется один раз на процесс
+var (
+	deleteQueueOnce  sync.Once
+	deleteQueueDepth atomic.Pointer[func() int]
+)
+
+// RegisterDeleteQueue публикует текущую глубину очереди удаления ссылок, повторный вызов заменяет источник
+func RegisterDeleteQueue(depth func() int) {
+	deleteQueueDepth.Store(&depth)
+	deleteQueueOnce.Do(
+		func() {
+			prometheus.MustRegister(
+				prometheus.NewGaugeFunc(
+					prometheus.GaugeOpts{
+						Namespace: namespace,
+						Name:      "delete_queue_depth",
+						Help:      "Количество ссылок, ожидающих удаления.",
+					}, func() float64 {
+						return float64((*deleteQueueDepth.Load())())
+					},
+				),
+			)
+		},
+	)
+}
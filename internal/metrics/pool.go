@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// poolCollector снимает статистику пула подключений pgx в момент запроса метрик
+type poolCollector struct {
+	pool atomic.Pointer[pgxpool.Pool] // Текущий пул, nil - статистика не публикуется
+
+	acquiredConns    *prometheus.Desc
+	idleConns        *prometheus.Desc
+	totalConns       *prometheus.Desc
+	maxConns         *prometheus.Desc
+	acquireCount     *prometheus.Desc
+	acquireDuration  *prometheus.Desc
+	emptyAcquire     *prometheus.Desc
+	canceledAcquire  *prometheus.Desc
+	constructingConn *prometheus.Desc
+}
+
+// Коллектор пула регистрируется в реестре Prometheus один раз на процесс,
+// иначе повторное создание сервиса завершилось бы паникой
+var (
+	poolOnce sync.Once
+	pools    = newPoolCollector()
+)
+
+func newPoolCollector() *poolCollector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "pgxpool", name), help, nil, nil)
+	}
+
+	return &poolCollector{
+		acquiredConns:    desc("acquired_conns", "Количество выданных подключений."),
+		idleConns:        desc("idle_conns", "Количество свободных подключений."),
+		totalConns:       desc("total_conns", "Общее количество подключений пула."),
+		maxConns:         desc("max_conns", "Максимальный размер пула."),
+		acquireCount:     desc("acquire_total", "Количество успешных получений подключения."),
+		acquireDuration:  desc("acquire_duration_seconds_total", "Суммарное время ожидания подключений."),
+		emptyAcquire:     desc("empty_acquire_total", "Количество получений подключения с ожиданием из-за пустого пула."),
+		canceledAcquire:  desc("canceled_acquire_total", "Количество получений подключения, отмененных контекстом."),
+		constructingConn: desc("constructing_conns", "Количество устанавливаемых подключений."),
+	}
+}
+
+// RegisterPool публикует статистику пула подключений pgx. Повторный вызов заменяет пул,
+// а nil снимает его статистику с публикации
+func RegisterPool(pool *pgxpool.Pool) {
+	pools.pool.Store(pool)
+	poolOnce.Do(
+		func() {
+			prometheus.MustRegister(pools)
+		},
+	)
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.acquiredConns
+	ch <- c.idleConns
+	ch <- c.totalConns
+	ch <- c.maxConns
+	ch <- c.acquireCount
+	ch <- c.acquireDuration
+	ch <- c.emptyAcquire
+	ch <- c.canceledAcquire
+	ch <- c.constructingConn
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	pool := c.pool.Load()
+	if pool == nil {
+		return
+	}
+	stat := pool.Stat()
+
+	ch <- prometheus.MustNewConstMetric(c.acquiredConns, prometheus.GaugeValue, float64(stat.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(c.idleConns, prometheus.GaugeValue, float64(stat.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(c.totalConns, prometheus.GaugeValue, float64(stat.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(c.maxConns, prometheus.GaugeValue, float64(stat.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(c.acquireCount, prometheus.CounterValue, float64(stat.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.acquireDuration, prometheus.CounterValue, stat.AcquireDuration().Seconds())
+	ch <- prometheus.MustNewConstMetric(c.emptyAcquire, prometheus.CounterValue, float64(stat.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.canceledAcquire, prometheus.CounterValue, float64(stat.CanceledAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.constructingConn, prometheus.GaugeValue, float64(stat.ConstructingConns()))
+}
@@ -0,0 +1,265 @@
+package migrations
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"github.com/jackc/pgx/v4"
+	"go.uber.org/zap"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Файлы миграций вида <версия>_<название>.up.sql и <версия>_<название>.down.sql
+//
+//go:embed sql/*.sql
+var files embed.FS
+
+// Ключ advisory lock, под которым миграции выполняет только один экземпляр сервиса
+const lockKey = 4519723
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status - состояние миграции в БД, AppliedAt равен nil для непримененной
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Load - функция для чтения встроенных в бинарный файл миграций в порядке версий
+func Load() ([]Migration, error) {
+	entries, err := fs.ReadDir(files, "sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		name := entry.Name()
+
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("unexpected migration file %s", name)
+		}
+
+		versionStr, title, ok := strings.Cut(strings.TrimSuffix(name, "."+direction+".sql"), "_")
+		if !ok {
+			return nil, fmt.Errorf("migration file %s has no name", name)
+		}
+		version, err := strconv.Atoi(versionStr)
+		if err != nil {
+			return nil, fmt.Errorf("migration file %s has invalid version: %w", name, err)
+		}
+
+		body, err := files.ReadFile("sql/" + name)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: title}
+			byVersion[version] = m
+		} else if m.Name != title {
+			return nil, fmt.Errorf("migration %d has different names: %s and %s", version, m.Name, title)
+		}
+
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d must have both up and down files", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(
+		migrations, func(i, j int) bool {
+			return migrations[i].Version < migrations[j].Version
+		},
+	)
+
+	return migrations, nil
+}
+
+type Migrator struct {
+	conn       *pgx.Conn
+	logger     *zap.Logger
+	migrations []Migration
+}
+
+func NewMigrator(conn *pgx.Conn, logger *zap.Logger) (*Migrator, error) {
+	migrations, err := Load()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		conn:       conn,
+		logger:     logger,
+		migrations: migrations,
+	}, nil
+}
+
+// Up применяет все непримененные миграции
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.withLock(
+		ctx, func() error {
+			applied, err := m.applied(ctx)
+			if err != nil {
+				return err
+			}
+
+			for _, migration := range m.migrations {
+				if _, ok := applied[migration.Version]; ok {
+					continue
+				}
+
+				err = m.apply(
+					ctx, migration.Up,
+					"INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", migration.Version, migration.Name,
+				)
+				if err != nil {
+					return fmt.Errorf("migration %d_%s up: %w", migration.Version, migration.Name, err)
+				}
+				m.logger.Info("Migration applied", zap.Int("version", migration.Version), zap.String("name", migration.Name))
+			}
+			return nil
+		},
+	)
+}
+
+// Down откатывает последнюю примененную миграцию
+func (m *Migrator) Down(ctx context.Context) error {
+	return m.withLock(
+		ctx, func() error {
+			applied, err := m.applied(ctx)
+			if err != nil {
+				return err
+			}
+
+			for i := len(m.migrations) - 1; i >= 0; i-- {
+				migration := m.migrations[i]
+				if _, ok := applied[migration.Version]; !ok {
+					continue
+				}
+
+				err = m.apply(ctx, migration.Down, "DELETE FROM schema_migrations WHERE version = $1", migration.Version)
+				if err != nil {
+					return fmt.Errorf("migration %d_%s down: %w", migration.Version, migration.Name, err)
+				}
+				m.logger.Info("Migration reverted", zap.Int("version", migration.Version), zap.String("name", migration.Name))
+				return nil
+			}
+
+			m.logger.Info("No migrations to revert")
+			return nil
+		},
+	)
+}
+
+// Status возвращает состояние всех известных миграций
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+	err := m.withLock(
+		ctx, func() error {
+			applied, err := m.applied(ctx)
+			if err != nil {
+				return err
+			}
+
+			statuses = make([]Status, 0, len(m.migrations))
+			for _, migration := range m.migrations {
+				status := Status{Migration: migration}
+				if appliedAt, ok := applied[migration.Version]; ok {
+					status.AppliedAt = &appliedAt
+				}
+				statuses = append(statuses, status)
+			}
+			return nil
+		},
+	)
+	return statuses, err
+}
+
+// withLock выполняет fn под advisory lock, чтобы экземпляры не применяли миграции одновременно
+func (m *Migrator) withLock(ctx context.Context, fn func() error) error {
+	if _, err := m.conn.Exec(ctx, "SELECT pg_advisory_lock($1)", lockKey); err != nil {
+		return fmt.Errorf("acquire migration lock: %w", err)
+	}
+	defer func() {
+		if _, err := m.conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", lockKey); err != nil {
+			m.logger.Error("Error releasing migration lock", zap.Error(err))
+		}
+	}()
+
+	_, err := m.conn.Exec(
+		ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INT PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)
+	`,
+	)
+	if err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	return fn()
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int]time.Time, error) {
+	rows, err := m.conn.Query(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// apply выполняет SQL миграции и изменение schema_migrations в одной транзакции
+func (m *Migrator) apply(ctx context.Context, sql string, track string, args ...interface{}) error {
+	tx, err := m.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err = tx.Exec(ctx, sql); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(ctx, track, args...); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS user_urls;
+DROP TABLE IF EXISTS urls;
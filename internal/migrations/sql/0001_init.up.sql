@@ -0,0 +1,22 @@
+-- Исходная схема; условия IF NOT EXISTS позволяют принять БД, созданную до появления миграций
+CREATE TABLE IF NOT EXISTS urls (
+    ID TEXT PRIMARY KEY,
+    URL TEXT,
+    UNIQUE (URL)
+);
+
+CREATE TABLE IF NOT EXISTS user_urls (
+    ID SERIAL PRIMARY KEY,
+    IDshortURL TEXT,
+    userID TEXT,
+    delFLAG BOOL DEFAULT false
+);
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_name_idshorturl') THEN
+        ALTER TABLE user_urls
+        ADD CONSTRAINT fk_name_IDshortURL
+        FOREIGN KEY (IDshortURL) REFERENCES urls (ID);
+    END IF;
+END $$;
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS clicks (
+    ID BIGSERIAL PRIMARY KEY,
+    IDshortURL TEXT NOT NULL REFERENCES urls (ID) ON DELETE CASCADE,
+    clicked_at TIMESTAMPTZ NOT NULL,
+    referrer TEXT,
+    user_agent TEXT,
+    ip_hash TEXT
+);
+
+CREATE INDEX IF NOT EXISTS clicks_idshorturl_clicked_at_idx ON clicks (IDshortURL, clicked_at);
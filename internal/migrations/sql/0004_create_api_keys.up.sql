@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS api_keys (
+    ID TEXT PRIMARY KEY,
+    userID TEXT NOT NULL,
+    name TEXT NOT NULL DEFAULT '',
+    key_hash TEXT NOT NULL UNIQUE,
+    scopes TEXT[] NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS api_keys_userid_idx ON api_keys (userID);
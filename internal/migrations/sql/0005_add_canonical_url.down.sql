@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS canonical_state;
+
+DROP INDEX IF EXISTS urls_canonical_url_key;
+
+ALTER TABLE urls DROP COLUMN IF EXISTS canonical_url;
+
+ALTER TABLE urls ADD CONSTRAINT urls_url_key UNIQUE (URL);
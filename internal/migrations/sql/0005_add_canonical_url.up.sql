@@ -0,0 +1,13 @@
+-- Дубликаты ищутся по каноническому виду URL вместо исходной строки. Существующие
+-- записи заполняются сервисом при запуске, пока значение NULL не участвует в уникальности
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS canonical_url TEXT;
+
+-- Настройки приведения, с которыми заполнен canonical_url: сервис пересчитывает его
+-- только при их смене, а не при каждом запуске
+CREATE TABLE IF NOT EXISTS canonical_state (
+    options TEXT NOT NULL
+);
+
+ALTER TABLE urls DROP CONSTRAINT IF EXISTS urls_url_key;
+
+CREATE UNIQUE INDEX IF NOT EXISTS urls_canonical_url_key ON urls (canonical_url);
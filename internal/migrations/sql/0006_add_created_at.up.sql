@@ -0,0 +1,5 @@
+-- Момент создания ссылки отдается клиенту при конфликте. У записей, сохраненных
+-- до появления колонки, он неизвестен и остается NULL, новые получают now()
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ;
+
+ALTER TABLE urls ALTER COLUMN created_at SET DEFAULT now();
@@ -1,63 +1,57 @@
 package routes
 
 import (
-	"context"
+	"github.com/egosha7/shortlink/internal/analytics"
 	"github.com/egosha7/shortlink/internal/auth"
 	"github.com/egosha7/shortlink/internal/cookiemw"
 	"github.com/egosha7/shortlink/internal/worker"
-	"github.com/jackc/pgx/v4/pgxpool"
 	"go.uber.org/zap"
 	"net/http"
-	"os"
 
 	"github.com/egosha7/shortlink/internal/compress"
 	"github.com/egosha7/shortlink/internal/config"
-	"github.com/egosha7/shortlink/internal/db"
 	"github.com/egosha7/shortlink/internal/handlers"
+	"github.com/egosha7/shortlink/internal/loger"
+	"github.com/egosha7/shortlink/internal/metrics"
 	"github.com/egosha7/shortlink/internal/storage"
 	"github.com/go-chi/chi"
-	"github.com/jackc/pgx/v4"
 )
 
-func SetupRoutes(cfg *config.Config, conn *pgx.Conn, logger *zap.Logger) http.Handler {
-	config, err := pgxpool.ParseConfig(cfg.DataBase)
-	if err != nil {
-		logger.Error("Error parse config", zap.Error(err))
-	}
-	config.MaxConns = 1000
-	// Создание пула подключений
-	pool, err := pgxpool.ConnectConfig(context.Background(), config)
-	if err != nil {
-		logger.Error("Error connect config", zap.Error(err))
-	}
-	// Создание хранилища
-	store := storage.NewURLStore(cfg.FilePath, cfg.DataBase, conn, logger, pool)
-	repo := storage.NewPostgresURLRepository(conn, logger, pool)
-	wkr := worker.NewWorker(store)
-
-	if cfg.DataBase != "" {
-		repo.CreateTable()
-	}
-
-	// Загрузка данных из файла
-	err = store.LoadFromFile()
-	if err != nil {
-		logger.Error("Error loading data from file", zap.Error(err)) // Используем логер для вывода ошибки
-		os.Exit(1)
-	}
+// Dependencies - зависимости обработчиков, собранные при запуске сервиса
+type Dependencies struct {
+	Store   storage.Storage
+	Backend string // Имя активного хранилища, отдается в /ping
+	Worker  *worker.Worker
+	Clicks  *analytics.Recorder
+	Keys    *auth.KeySet
+}
+
+// SetupRoutes создает роутер сервиса поверх уже собранных зависимостей
+func SetupRoutes(cfg *config.Config, deps Dependencies, logger *zap.Logger) http.Handler {
+	store, wkr, clicks, keys := deps.Store, deps.Worker, deps.Clicks, deps.Keys
 
 	// Создание роутера
 	r := chi.NewRouter()
+	r.Use(metrics.Middleware)
+
+	r.Handle("/metrics", metrics.Handler())
 
-	gzipMiddleware := compress.GzipMiddleware{}
+	gzipMiddleware := compress.GzipMiddleware{MaxBodySize: cfg.MaxBodySize}
 
 	// Создание группы роутера
 	r.Group(
 		func(route chi.Router) {
-			route.Use(cookiemw.CookieMiddleware)
+			route.Use(handlers.StorageTimeouts(storage.Timeouts{Read: cfg.StorageReadTimeout, Write: cfg.StorageWriteTimeout}))
+			route.Use(cookiemw.CookieMiddleware(keys, store))
 			route.Use(gzipMiddleware.Apply)
 
-			route.Delete(
+			// Ключам доступа разрешены только маршруты из их областей доступа
+			shorten := route.With(cookiemw.RequireScope(auth.ScopeShorten), handlers.MaxBodySize(cfg.MaxBodySize))
+			read := route.With(cookiemw.RequireScope(auth.ScopeRead))
+			remove := route.With(cookiemw.RequireScope(auth.ScopeDelete))
+			session := route.With(cookiemw.RequireSession)
+
+			remove.Delete(
 				"/api/user/urls", func(w http.ResponseWriter, r *http.Request) {
 					handlers.DeleteUserURLsHandler(w, r, wkr)
 				},
@@ -65,46 +59,79 @@ func SetupRoutes(cfg *config.Config, conn *pgx.Conn, logger *zap.Logger) http.Ha
 
 			route.Get(
 				"/cookie/set", func(w http.ResponseWriter, r *http.Request) {
-					auth.SetCookieHandler(w, r)
+					if _, err := auth.SetCookieHandler(w, r, keys); err != nil {
+						loger.SetError(r.Context(), err)
+						http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+					}
 				},
 			)
 
 			route.Get(
 				"/{id}", func(w http.ResponseWriter, r *http.Request) {
-					handlers.RedirectURL(w, r, store)
+					handlers.RedirectURL(w, r, store, clicks)
 				},
 			)
 
 			route.Get(
 				"/ping", func(w http.ResponseWriter, r *http.Request) {
-					db.PingDB(w, r, conn)
+					handlers.PingHandler(w, r, store, deps.Backend, logger)
 				},
 			)
 
-			route.Get(
+			read.Get(
 				"/api/user/urls", func(w http.ResponseWriter, r *http.Request) {
 					handlers.GetUserURLsHandler(w, r, cfg.BaseURL, store, logger)
 				},
 			)
 
-			route.Post(
+			read.Get(
+				"/api/user/urls/{id}/stats", func(w http.ResponseWriter, r *http.Request) {
+					handlers.GetURLStatsHandler(w, r, cfg.BaseURL, store, clicks, logger)
+				},
+			)
+
+			shorten.Post(
 				"/", func(w http.ResponseWriter, r *http.Request) {
 					handlers.ShortenURL(w, r, cfg.BaseURL, store, logger)
 				},
 			)
 
-			route.Post(
+			shorten.Post(
 				"/api/shorten", func(w http.ResponseWriter, r *http.Request) {
 					handlers.HandleShortenURL(w, r, cfg.BaseURL, store)
 				},
 			)
 
-			route.Post(
+			session.Post(
+				"/api/auth/token", func(w http.ResponseWriter, r *http.Request) {
+					handlers.IssueTokenHandler(w, r, keys, logger)
+				},
+			)
+
+			shorten.Post(
 				"/api/shorten/batch", func(w http.ResponseWriter, r *http.Request) {
 					handlers.HandleShortenBatch(w, r, cfg.BaseURL, store)
 				},
 			)
 
+			session.Post(
+				"/api/user/keys", func(w http.ResponseWriter, r *http.Request) {
+					handlers.CreateAPIKeyHandler(w, r, store, logger)
+				},
+			)
+
+			session.Get(
+				"/api/user/keys", func(w http.ResponseWriter, r *http.Request) {
+					handlers.ListAPIKeysHandler(w, r, store)
+				},
+			)
+
+			session.Delete(
+				"/api/user/keys/{id}", func(w http.ResponseWriter, r *http.Request) {
+					handlers.DeleteAPIKeyHandler(w, r, store)
+				},
+			)
+
 		},
 	)
 
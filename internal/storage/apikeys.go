@@ -0,0 +1,26 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// APIKey - ключ доступа для межсервисных интеграций, сам ключ хранится только в виде хеша
+type APIKey struct {
+	ID        string
+	UserID    string
+	Name      string
+	Hash      string
+	Scopes    []string
+	CreatedAt time.Time
+}
+
+// APIKeyStorage - интерфейс хранилища ключей доступа
+type APIKeyStorage interface {
+	AddAPIKey(ctx context.Context, key APIKey) error
+	// GetAPIKeyByHash возвращает ErrNotFound, если ключ не выпускался или отозван
+	GetAPIKeyByHash(ctx context.Context, hash string) (APIKey, error)
+	GetAPIKeysByUserID(ctx context.Context, userID string) ([]APIKey, error)
+	// DeleteAPIKey удаляет ключ пользователя, ErrNotFound - ключ не найден
+	DeleteAPIKey(ctx context.Context, id, userID string) error
+}
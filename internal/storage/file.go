@@ -0,0 +1,466 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"io"
+	"os"
+	"time"
+)
+
+// Типы событий журнала файлового хранилища
+const (
+	eventCreate = "create"
+	eventDelete = "delete"
+	eventExpire = "expire" // Удаление просроченных ссылок без учета владельца
+
+	eventKeyCreate = "key_create"
+	eventKeyDelete = "key_delete"
+)
+
+// fileEvent - одна строка журнала: изменение ссылок или ключей доступа
+type fileEvent struct {
+	Type   string   `json:"type"`
+	URLs   []URL    `json:"urls,omitempty"`
+	IDs    []string `json:"ids,omitempty"`
+	UserID string   `json:"user_id,omitempty"`
+	Key    *APIKey  `json:"key,omitempty"`
+}
+
+// FileStore - хранилище ссылок в памяти с журналом событий в JSONL-файле
+type FileStore struct {
+	*MemoryStore
+	filePath string
+	file     *os.File
+	deletes  int // Количество событий удаления с момента последнего уплотнения
+	done     chan struct{}
+}
+
+func NewFileStore(filePath string, logger *zap.Logger) *FileStore {
+	return &FileStore{
+		MemoryStore: NewMemoryStore(logger),
+		filePath:    filePath,
+		done:        make(chan struct{}),
+	}
+}
+
+func (s *FileStore) AddURL(ctx context.Context, id, url, userID string, expiresAt *time.Time) (AddResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := len(s.ids)
+	res, err := s.addURL(id, url, userID, expiresAt)
+	if err != nil {
+		return res, err
+	}
+
+	// Дописываем событие в журнал, при ошибке откатываем ссылку и в памяти
+	if err = s.appendEvent(fileEvent{Type: eventCreate, URLs: s.records(n)}); err != nil {
+		s.truncate(n)
+		return AddResult{}, unavailable(err)
+	}
+
+	return res, nil
+}
+
+func (s *FileStore) AddURLWithAlias(ctx context.Context, alias, url, userID string, expiresAt *time.Time) (AddResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := len(s.ids)
+	res, err := s.addAlias(alias, url, userID, expiresAt)
+	if err != nil {
+		return res, err
+	}
+
+	// Дописываем событие в журнал, при ошибке откатываем ссылку и в памяти
+	if err = s.appendEvent(fileEvent{Type: eventCreate, URLs: s.records(n)}); err != nil {
+		s.truncate(n)
+		return AddResult{}, unavailable(err)
+	}
+
+	return res, nil
+}
+
+// DeleteURLs, как и DeleteURLsBatch, дописывает событие, даже если ссылки уже помечены удаленными
+func (s *FileStore) DeleteURLs(ctx context.Context, urls []string, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deleteURLs(urls, userID)
+
+	// Дописываем событие в журнал
+	if err := s.appendEvent(fileEvent{Type: eventDelete, IDs: urls, UserID: userID}); err != nil {
+		return unavailable(err)
+	}
+	return nil
+}
+
+// DeleteURLsBatch дописывает событие удаления для каждого пользователя, даже если
+// ссылки уже помечены удаленными: повторная попытка после ошибки записи не должна терять событие
+func (s *FileStore) DeleteURLsBatch(ctx context.Context, deletions []Deletion) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	users, byUser := groupDeletions(deletions)
+	for _, userID := range users {
+		s.deleteURLs(byUser[userID], userID)
+
+		// Дописываем событие в журнал
+		err := s.appendEvent(fileEvent{Type: eventDelete, IDs: byUser[userID], UserID: userID})
+		if err != nil {
+			return unavailable(err)
+		}
+	}
+	return nil
+}
+
+// DeleteExpiredURLs возвращает количество просроченных ссылок, даже если событие не удалось записать:
+// при повторной загрузке они все равно будут считаться удаленными по сроку жизни
+func (s *FileStore) DeleteExpiredURLs(ctx context.Context, now time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expired := s.deleteExpired(now)
+	if len(expired) == 0 {
+		return 0, nil
+	}
+
+	// Дописываем событие в журнал
+	if err := s.appendEvent(fileEvent{Type: eventExpire, IDs: expired}); err != nil {
+		return len(expired), unavailable(err)
+	}
+	return len(expired), nil
+}
+
+func (s *FileStore) AddURLwithTx(ctx context.Context, records []map[string]string, BaseURL string, userID string) ([]map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := len(s.ids)
+	res, err := s.addBatch(records, BaseURL, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Пакет записывается одной строкой журнала, при ошибке откатываем его и в памяти
+	if err = s.appendEvent(fileEvent{Type: eventCreate, URLs: s.records(n)}); err != nil {
+		s.truncate(n)
+		return nil, unavailable(err)
+	}
+
+	return res, nil
+}
+
+func (s *FileStore) AddAPIKey(ctx context.Context, key APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.addAPIKey(key); err != nil {
+		return err
+	}
+
+	// Дописываем событие в журнал, при ошибке откатываем ключ и в памяти
+	if err := s.appendEvent(fileEvent{Type: eventKeyCreate, Key: &key}); err != nil {
+		s.deleteAPIKey(key.ID, key.UserID)
+		return unavailable(err)
+	}
+	return nil
+}
+
+func (s *FileStore) DeleteAPIKey(ctx context.Context, id, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.deleteAPIKey(id, userID)
+	if !ok {
+		return ErrNotFound
+	}
+
+	// Дописываем событие в журнал, при ошибке возвращаем ключ и в памяти
+	if err := s.appendEvent(fileEvent{Type: eventKeyDelete, IDs: []string{id}, UserID: userID}); err != nil {
+		s.addAPIKey(key)
+		return unavailable(err)
+	}
+	return nil
+}
+
+// appendEvent дописывает событие в конец журнала одной записью, вызывающий должен удерживать s.mu
+func (s *FileStore) appendEvent(event fileEvent) error {
+	if s.file == nil {
+		return errors.New("file storage is not loaded")
+	}
+
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	// Запоминаем конец журнала: при частичной записи обрезаем ее, иначе следующее
+	// событие склеится с оборванной строкой и журнал не загрузится
+	offset, err := s.file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if _, err = s.file.Write(append(line, '\n')); err != nil {
+		if truncErr := s.file.Truncate(offset); truncErr != nil {
+			return errors.Join(err, truncErr)
+		}
+		return err
+	}
+	switch event.Type {
+	case eventDelete, eventExpire, eventKeyDelete:
+		s.deletes++
+	}
+
+	return nil
+}
+
+// LoadFromFile восстанавливает состояние из журнала и открывает его на дозапись
+func (s *FileStore) LoadFromFile() error {
+	// Проверка наличия флага или переменной окружения
+	if s.filePath == "" {
+		return nil // Если значение не установлено, выходим без загрузки данных
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.filePath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		// Файл в прежнем формате JSON-массива, переводим его в журнал
+		var urls []URL
+		if err = json.Unmarshal(data, &urls); err != nil {
+			return err
+		}
+		for _, u := range urls {
+			u.Canonical = s.canon.Canonical(u.URL)
+			s.insert(u)
+		}
+		return s.compact()
+	}
+
+	size, err := s.replay(data)
+	if err != nil {
+		return err
+	}
+
+	// Журнал содержит события удаления, сразу уплотняем его
+	if s.deletes > 0 {
+		return s.compact()
+	}
+
+	return s.openJournal(size, size == 0 || data[size-1] == '\n')
+}
+
+// openJournal открывает журнал на дозапись, отбрасывая оборванный хвост после первых size байт:
+// иначе следующее событие склеится с ним в одну нечитаемую строку. Если последняя целая запись
+// не завершена переводом строки (terminated == false), он дописывается
+func (s *FileStore) openJournal(size int64, terminated bool) error {
+	file, err := os.OpenFile(s.filePath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+	if err != nil {
+		return err
+	}
+
+	if err = file.Truncate(size); err == nil && !terminated {
+		_, err = file.Write([]byte{'\n'})
+	}
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	s.file = file
+	return nil
+}
+
+// replay применяет события журнала к хранилищу в памяти и возвращает размер
+// прочитанной части без оборванной последней записи
+func (s *FileStore) replay(data []byte) (int64, error) {
+	var size int64
+	reader := bufio.NewReader(bytes.NewReader(data))
+	for lineNum := 1; ; lineNum++ {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		last := err == io.EOF
+
+		if len(bytes.TrimSpace(line)) > 0 {
+			var event fileEvent
+			if decodeErr := json.Unmarshal(line, &event); decodeErr != nil {
+				if last {
+					// Последняя запись оборвана при аварийном завершении, пропускаем ее
+					s.logger.Warn("Skipping truncated record in file", zap.Int("line", lineNum))
+					break
+				}
+				return 0, fmt.Errorf("line %d: %w", lineNum, decodeErr)
+			}
+			s.apply(event)
+		}
+		size += int64(len(line))
+
+		if last {
+			break
+		}
+	}
+	return size, nil
+}
+
+func (s *FileStore) apply(event fileEvent) {
+	switch event.Type {
+	case eventCreate:
+		for _, u := range event.URLs {
+			// Канонический вид пересчитывается: записи старого формата его не содержат,
+			// а настройки приведения могли измениться
+			u.Canonical = s.canon.Canonical(u.URL)
+			s.insert(u)
+		}
+	case eventDelete:
+		s.deleteURLs(event.IDs, event.UserID)
+		s.deletes++
+	case eventExpire:
+		s.markDeleted(event.IDs)
+		s.deletes++
+	case eventKeyCreate:
+		if event.Key == nil {
+			break
+		}
+		if err := s.addAPIKey(*event.Key); err != nil {
+			s.logger.Warn("Skipping api key from file", zap.Error(err))
+		}
+	case eventKeyDelete:
+		for _, id := range event.IDs {
+			s.deleteAPIKey(id, event.UserID)
+		}
+		s.deletes++
+	default:
+		s.logger.Warn("Unknown event in file", zap.String("type", event.Type))
+	}
+}
+
+// Compact перезаписывает журнал снимком текущего состояния
+func (s *FileStore) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.compact()
+}
+
+// compact пишет снимок во временный файл и атомарно подменяет им журнал, вызывающий должен удерживать s.mu
+func (s *FileStore) compact() error {
+	tmpPath := s.filePath + ".tmp"
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	urls := s.records(0)
+	for i := range urls {
+		if err = enc.Encode(fileEvent{Type: eventCreate, URLs: urls[i : i+1]}); err != nil {
+			break
+		}
+	}
+	keys := s.apiKeys()
+	for i := range keys {
+		if err != nil {
+			break
+		}
+		err = enc.Encode(fileEvent{Type: eventKeyCreate, Key: &keys[i]})
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, s.filePath)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	// Переоткрываем журнал, так как прежний дескриптор указывает на замененный файл
+	if s.file != nil {
+		s.file.Close()
+	}
+	s.file, err = os.OpenFile(s.filePath, os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	s.deletes = 0
+
+	return nil
+}
+
+// RunCompaction периодически уплотняет журнал до вызова Close
+func (s *FileStore) RunCompaction(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			if s.deletes > 0 {
+				if err := s.compact(); err != nil {
+					s.logger.Error("Error compacting file", zap.Error(err))
+				}
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+// Ping проверяет, что журнал открыт и доступен для записи
+func (s *FileStore) Ping(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return errors.New("file storage is closed")
+	}
+	_, err := s.file.Stat()
+	return err
+}
+
+// Close останавливает уплотнение, сбрасывает журнал на диск и закрывает его
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	select {
+	case <-s.done:
+		return nil
+	default:
+		close(s.done)
+	}
+
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Sync()
+	if closeErr := s.file.Close(); err == nil {
+		err = closeErr
+	}
+	s.file = nil
+	return err
+}
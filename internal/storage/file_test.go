@@ -0,0 +1,223 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestFileStoreReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "urls.jsonl")
+	logger := zap.NewNop()
+
+	store := NewFileStore(path, logger)
+	if err := store.LoadFromFile(); err != nil {
+		t.Fatal(err)
+	}
+	store.AddURL(context.Background(), "a1", "http://a.example.com", "user1", nil)
+	created, _ := store.AddURL(context.Background(), "b2", "http://b.example.com", "user1", nil)
+	store.DeleteURLs(context.Background(), []string{"a1"}, "user1")
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Имитируем оборванную при падении процесса запись
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"type":"create","urls":[{"ID":"c3"`)
+	file.Close()
+
+	restored := NewFileStore(path, logger)
+	if err := restored.LoadFromFile(); err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+
+	if url, err := restored.GetURL(context.Background(), "a1"); !errors.Is(err, ErrDeleted) {
+		t.Errorf("deleted URL restored as: %q, %v", url, err)
+	}
+	if url, err := restored.GetURL(context.Background(), "b2"); url != "http://b.example.com" || err != nil {
+		t.Errorf("URL restored as: %q, %v", url, err)
+	}
+	if _, err := restored.GetURL(context.Background(), "c3"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("truncated record was restored")
+	}
+
+	// Удаленная ссылка после загрузки не занимает свой URL
+	if res, err := restored.AddURL(context.Background(), "e5", "http://a.example.com", "user2", nil); err != nil || res.ID != "e5" {
+		t.Errorf("deleted URL not shortened again: %+v, %v", res, err)
+	}
+
+	// Момент создания сохраняется в журнале и возвращается при конфликте
+	existing, err := restored.AddURL(context.Background(), "d4", "http://b.example.com", "user2", nil)
+	if !errors.Is(err, ErrURLExists) || existing.UserID != "user1" || !existing.CreatedAt.Equal(created.CreatedAt) {
+		t.Errorf("got %+v, %v, want %+v", existing, err, created)
+	}
+}
+
+func TestFileStoreTruncatedTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "urls.jsonl")
+	logger := zap.NewNop()
+
+	store := NewFileStore(path, logger)
+	if err := store.LoadFromFile(); err != nil {
+		t.Fatal(err)
+	}
+	store.AddURL(context.Background(), "a1", "http://a.example.com", "user1", nil)
+	store.Close()
+
+	// Оборванная запись без событий удаления: журнал при загрузке не уплотняется
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"type":"create","urls":[{"ID":"x0"`)
+	file.Close()
+
+	// Каждый перезапуск дописывает ссылку, все они должны пережить следующий
+	ids := []string{"a1", "b2", "c3"}
+	for i, id := range ids[1:] {
+		restarted := NewFileStore(path, logger)
+		if err := restarted.LoadFromFile(); err != nil {
+			t.Fatalf("restart %d: %v", i+1, err)
+		}
+		if _, err := restarted.AddURL(context.Background(), id, "http://"+id+".example.com", "user1", nil); err != nil {
+			t.Fatal(err)
+		}
+		restarted.Close()
+	}
+
+	restored := NewFileStore(path, logger)
+	if err := restored.LoadFromFile(); err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+
+	for _, id := range ids {
+		if _, err := restored.GetURL(context.Background(), id); err != nil {
+			t.Errorf("URL %s lost after restart: %v", id, err)
+		}
+	}
+}
+
+func TestFileStoreLegacyFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "urls.json")
+	err := os.WriteFile(path, []byte(`[{"ID":"a1","URL":"http://a.example.com","UserID":"user1"}]`), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := NewFileStore(path, zap.NewNop())
+	if err := store.LoadFromFile(); err != nil {
+		t.Fatal(err)
+	}
+	store.AddURL(context.Background(), "b2", "http://b.example.com", "user1", nil)
+	store.Close()
+
+	restored := NewFileStore(path, zap.NewNop())
+	if err := restored.LoadFromFile(); err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+
+	if urls, _ := restored.GetURLsByUserID(context.Background(), "user1"); len(urls) != 2 {
+		t.Errorf("got %d URLs after conversion, want 2", len(urls))
+	}
+}
+
+func TestFileStoreAPIKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "urls.jsonl")
+	logger := zap.NewNop()
+
+	store := NewFileStore(path, logger)
+	if err := store.LoadFromFile(); err != nil {
+		t.Fatal(err)
+	}
+	store.AddAPIKey(context.Background(), APIKey{ID: "k1", UserID: "user1", Hash: "h1", Scopes: []string{"read"}})
+	store.AddAPIKey(context.Background(), APIKey{ID: "k2", UserID: "user1", Hash: "h2", Scopes: []string{"shorten"}})
+	if err := store.DeleteAPIKey(context.Background(), "k1", "user2"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("key deleted by another user")
+	}
+	store.DeleteAPIKey(context.Background(), "k1", "user1")
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := NewFileStore(path, logger)
+	if err := restored.LoadFromFile(); err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+
+	if _, err := restored.GetAPIKeyByHash(context.Background(), "h1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("deleted key restored")
+	}
+	if key, err := restored.GetAPIKeyByHash(context.Background(), "h2"); err != nil || key.UserID != "user1" || len(key.Scopes) != 1 {
+		t.Errorf("key restored as: %+v, %v", key, err)
+	}
+}
+
+func TestFileStoreDeleteRetry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "urls.jsonl")
+	logger := zap.NewNop()
+
+	store := NewFileStore(path, logger)
+	if err := store.LoadFromFile(); err != nil {
+		t.Fatal(err)
+	}
+	store.AddURL(context.Background(), "a1", "http://a.example.com", "user1", nil)
+	store.AddAPIKey(context.Background(), APIKey{ID: "k1", UserID: "user1", Hash: "h1"})
+
+	// Имитируем ошибку записи в журнал
+	store.file.Close()
+	if err := store.DeleteURLs(context.Background(), []string{"a1"}, "user1"); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("got %v, want ErrUnavailable", err)
+	}
+	if err := store.DeleteAPIKey(context.Background(), "k1", "user1"); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("got %v, want ErrUnavailable", err)
+	}
+	if _, err := store.GetAPIKeyByHash(context.Background(), "h1"); err != nil {
+		t.Errorf("key not restored after failed delete: %v", err)
+	}
+
+	// Повторное удаление после восстановления журнала должно попасть в него
+	if err := store.openJournal(fileSize(t, path), true); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.DeleteURLs(context.Background(), []string{"a1"}, "user1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.DeleteAPIKey(context.Background(), "k1", "user1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := NewFileStore(path, logger)
+	if err := restored.LoadFromFile(); err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+
+	if _, err := restored.GetURL(context.Background(), "a1"); !errors.Is(err, ErrDeleted) {
+		t.Errorf("retried delete lost: %v", err)
+	}
+	if _, err := restored.GetAPIKeyByHash(context.Background(), "h1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("retried key delete lost: %v", err)
+	}
+}
+
+func fileSize(t *testing.T, path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Size()
+}
@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"github.com/egosha7/shortlink/internal/loger"
+	"github.com/egosha7/shortlink/internal/metrics"
+	"go.uber.org/zap"
+	"time"
+)
+
+// instrumentedStorage учитывает время операций хранилища в метриках с меткой backend
+// и пишет в лог их сбои вместе с ID запроса
+type instrumentedStorage struct {
+	Storage
+	backend string
+	logger  *zap.Logger
+}
+
+// Instrument - функция для подключения метрик и логирования сбоев к хранилищу
+func Instrument(store Storage, backend string, logger *zap.Logger) Storage {
+	return &instrumentedStorage{Storage: store, backend: backend, logger: logger}
+}
+
+// observe учитывает время операции и логирует ее сбой. Ожидаемые исходы - отсутствующая,
+// удаленная или уже сохраненная ссылка - сбоем не считаются
+func (s *instrumentedStorage) observe(ctx context.Context, operation string, start time.Time, err *error) {
+	metrics.ObserveStorage(s.backend, operation, start)
+
+	if *err == nil || errors.Is(*err, ErrNotFound) || errors.Is(*err, ErrDeleted) || errors.Is(*err, ErrConflict) {
+		return
+	}
+	loger.FromContext(ctx, s.logger).Warn(
+		"Storage operation failed",
+		zap.String("backend", s.backend),
+		zap.String("operation", operation),
+		zap.Duration("duration", time.Since(start)),
+		zap.Error(*err),
+	)
+}
+
+func (s *instrumentedStorage) AddURL(ctx context.Context, id, url, userID string, expiresAt *time.Time) (res AddResult, err error) {
+	defer s.observe(ctx, "add_url", time.Now(), &err)
+	return s.Storage.AddURL(ctx, id, url, userID, expiresAt)
+}
+
+func (s *instrumentedStorage) AddURLWithAlias(ctx context.Context, alias, url, userID string, expiresAt *time.Time) (res AddResult, err error) {
+	defer s.observe(ctx, "add_url_with_alias", time.Now(), &err)
+	return s.Storage.AddURLWithAlias(ctx, alias, url, userID, expiresAt)
+}
+
+func (s *instrumentedStorage) AddURLwithTx(ctx context.Context, records []map[string]string, BaseURL string, userID string) (res []map[string]string, err error) {
+	defer s.observe(ctx, "add_url_batch", time.Now(), &err)
+	return s.Storage.AddURLwithTx(ctx, records, BaseURL, userID)
+}
+
+func (s *instrumentedStorage) GetURL(ctx context.Context, id string) (url string, err error) {
+	defer s.observe(ctx, "get_url", time.Now(), &err)
+	return s.Storage.GetURL(ctx, id)
+}
+
+func (s *instrumentedStorage) GetURLsByUserID(ctx context.Context, userID string) (urls []URL, err error) {
+	defer s.observe(ctx, "get_urls_by_user", time.Now(), &err)
+	return s.Storage.GetURLsByUserID(ctx, userID)
+}
+
+func (s *instrumentedStorage) GetURLOwner(ctx context.Context, id string) (owner string, err error) {
+	defer s.observe(ctx, "get_url_owner", time.Now(), &err)
+	return s.Storage.GetURLOwner(ctx, id)
+}
+
+func (s *instrumentedStorage) DeleteURLs(ctx context.Context, urls []string, userID string) (err error) {
+	defer s.observe(ctx, "delete_urls", time.Now(), &err)
+	return s.Storage.DeleteURLs(ctx, urls, userID)
+}
+
+func (s *instrumentedStorage) DeleteURLsBatch(ctx context.Context, deletions []Deletion) (err error) {
+	defer s.observe(ctx, "delete_urls_batch", time.Now(), &err)
+	return s.Storage.DeleteURLsBatch(ctx, deletions)
+}
+
+func (s *instrumentedStorage) DeleteExpiredURLs(ctx context.Context, now time.Time) (n int, err error) {
+	defer s.observe(ctx, "delete_expired_urls", time.Now(), &err)
+	return s.Storage.DeleteExpiredURLs(ctx, now)
+}
+
+func (s *instrumentedStorage) GetAPIKeyByHash(ctx context.Context, hash string) (key APIKey, err error) {
+	defer s.observe(ctx, "get_api_key", time.Now(), &err)
+	return s.Storage.GetAPIKeyByHash(ctx, hash)
+}
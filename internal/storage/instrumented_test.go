@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/egosha7/shortlink/internal/loger"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestInstrumentedStorageLogsRequestID(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	logger := zap.New(core)
+
+	// Журнал не открыт, поэтому любая запись завершается сбоем
+	store := Instrument(NewFileStore(filepath.Join(t.TempDir(), "urls.jsonl"), zap.NewNop()), BackendFile, logger)
+
+	handler := loger.LogMiddleware(
+		zap.NewNop(), http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				store.GetURL(r.Context(), "missing")
+				store.AddURL(r.Context(), "abc123", "http://example.com", "user1", nil)
+			},
+		),
+	)
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Header.Set(loger.RequestIDHeader, "req-1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	// Отсутствующая ссылка сбоем не считается, ошибка записи логируется с ID запроса
+	entries := logs.FilterMessage("Storage operation failed").AllUntimed()
+	if len(entries) != 1 {
+		t.Fatalf("got %d failure logs, want 1", len(entries))
+	}
+	fields := entries[0].ContextMap()
+	if fields["request_id"] != "req-1" || fields["operation"] != "add_url" {
+		t.Errorf("unexpected log fields: %v", fields)
+	}
+}
@@ -0,0 +1,518 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"github.com/egosha7/shortlink/internal/helpers"
+	"github.com/egosha7/shortlink/internal/urlcanon"
+	"go.uber.org/zap"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Количество сегментов индексов, чтение разных ссылок не конкурирует за одну блокировку
+const shardCount = 32
+
+// urlShard - сегмент индекса ссылок по короткому ID
+type urlShard struct {
+	mu   sync.RWMutex
+	byID map[string]URL
+}
+
+// userShard - сегмент индекса коротких ID по пользователю
+type userShard struct {
+	mu     sync.RWMutex
+	byUser map[string][]string
+}
+
+// MemoryStore - хранилище ссылок в памяти процесса
+type MemoryStore struct {
+	// mu сериализует изменения хранилища, чтение защищено блокировками сегментов
+	mu     sync.Mutex
+	ids    []string          // Короткие ID в порядке добавления
+	byURL  map[string]string // Канонический URL -> короткий ID, используется только при записи
+	canon  urlcanon.Options
+	urls   [shardCount]*urlShard
+	users  [shardCount]*userShard
+	logger *zap.Logger
+
+	// Ключи доступа читаются на каждом запросе с X-API-Key, поэтому у них своя блокировка
+	keysMu     sync.RWMutex
+	keysByHash map[string]APIKey
+	keysByID   map[string]string // ID ключа -> хеш
+}
+
+func NewMemoryStore(logger *zap.Logger) *MemoryStore {
+	s := &MemoryStore{
+		ids:        make([]string, 0),
+		byURL:      make(map[string]string),
+		canon:      urlcanon.Default(),
+		logger:     logger,
+		keysByHash: make(map[string]APIKey),
+		keysByID:   make(map[string]string),
+	}
+	for i := range s.urls {
+		s.urls[i] = &urlShard{byID: make(map[string]URL)}
+		s.users[i] = &userShard{byUser: make(map[string][]string)}
+	}
+	return s
+}
+
+// shardIndex - хеш FNV-1a ключа по модулю количества сегментов
+func shardIndex(key string) uint32 {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return h % shardCount
+}
+
+func (s *MemoryStore) shardByID(id string) *urlShard {
+	return s.urls[shardIndex(id)]
+}
+
+func (s *MemoryStore) shardByUser(userID string) *userShard {
+	return s.users[shardIndex(userID)]
+}
+
+func (s *MemoryStore) DeleteURLs(ctx context.Context, urls []string, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deleteURLs(urls, userID)
+	return nil
+}
+
+func (s *MemoryStore) DeleteURLsBatch(ctx context.Context, deletions []Deletion) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	users, byUser := groupDeletions(deletions)
+	for _, userID := range users {
+		s.deleteURLs(byUser[userID], userID)
+	}
+	return nil
+}
+
+// deleteURLs помечает ссылки пользователя удаленными и возвращает их количество, вызывающий должен удерживать s.mu
+func (s *MemoryStore) deleteURLs(urls []string, userID string) int {
+	deleted := 0
+	for _, id := range urls {
+		shard := s.shardByID(id)
+		shard.mu.Lock()
+		u, ok := shard.byID[id]
+		if ok && u.UserID == userID && !u.Deleted {
+			u.Deleted = true
+			shard.byID[id] = u
+			s.release(u)
+			deleted++
+		}
+		shard.mu.Unlock()
+	}
+	return deleted
+}
+
+// release освобождает канонический URL удаленной или просроченной ссылки, чтобы его
+// можно было сократить снова, вызывающий должен удерживать s.mu
+func (s *MemoryStore) release(u URL) {
+	if s.byURL[u.Canonical] == u.ID {
+		delete(s.byURL, u.Canonical)
+	}
+}
+
+// Ping всегда успешен, хранилище в памяти доступно, пока работает процесс
+func (s *MemoryStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+// Close ничего не делает, данные в памяти не требуют сохранения
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+func (s *MemoryStore) DeleteExpiredURLs(ctx context.Context, now time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.deleteExpired(now)), nil
+}
+
+// deleteExpired помечает удаленными просроченные ссылки и возвращает их ID, вызывающий должен удерживать s.mu
+func (s *MemoryStore) deleteExpired(now time.Time) []string {
+	var expired []string
+	for _, shard := range s.urls {
+		shard.mu.Lock()
+		for id, u := range shard.byID {
+			if u.Deleted || !u.Expired(now) {
+				continue
+			}
+			u.Deleted = true
+			shard.byID[id] = u
+			s.release(u)
+			expired = append(expired, id)
+		}
+		shard.mu.Unlock()
+	}
+	return expired
+}
+
+// markDeleted помечает ссылки удаленными независимо от владельца, вызывающий должен удерживать s.mu
+func (s *MemoryStore) markDeleted(ids []string) {
+	for _, id := range ids {
+		shard := s.shardByID(id)
+		shard.mu.Lock()
+		if u, ok := shard.byID[id]; ok {
+			u.Deleted = true
+			shard.byID[id] = u
+			s.release(u)
+		}
+		shard.mu.Unlock()
+	}
+}
+
+func (s *MemoryStore) AddURL(ctx context.Context, id, url, userID string, expiresAt *time.Time) (AddResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.addURL(id, url, userID, expiresAt)
+}
+
+// addURL добавляет ссылку, вызывающий должен удерживать s.mu
+func (s *MemoryStore) addURL(id, url, userID string, expiresAt *time.Time) (AddResult, error) {
+	// Проверка наличия дубликата ID
+	for s.hasID(id) {
+		// ID уже существует в хранилище, генерируем новый
+		id = helpers.GenerateID(6)
+	}
+
+	// Проверка наличия дубликата URL по каноническому виду
+	canonical := s.canon.Canonical(url)
+	if existing, ok := s.existing(canonical); ok {
+		// URL уже существует в хранилище, возвращаем соответствующую ссылку
+		return existing, ErrURLExists
+	}
+
+	u := URL{ID: id, URL: url, Canonical: canonical, UserID: userID, ExpiresAt: expiresAt, CreatedAt: time.Now()}
+	s.insert(u)
+
+	return u.result(), nil
+}
+
+func (s *MemoryStore) AddURLWithAlias(ctx context.Context, alias, url, userID string, expiresAt *time.Time) (AddResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.addAlias(alias, url, userID, expiresAt)
+}
+
+// addAlias добавляет ссылку под заданным ID, вызывающий должен удерживать s.mu
+func (s *MemoryStore) addAlias(alias, url, userID string, expiresAt *time.Time) (AddResult, error) {
+	if s.hasID(alias) {
+		return AddResult{}, ErrAliasExists
+	}
+	canonical := s.canon.Canonical(url)
+	if existing, ok := s.existing(canonical); ok {
+		return existing, ErrURLExists
+	}
+
+	u := URL{ID: alias, URL: url, Canonical: canonical, UserID: userID, ExpiresAt: expiresAt, CreatedAt: time.Now()}
+	s.insert(u)
+
+	return u.result(), nil
+}
+
+// existing возвращает действующую ссылку, сохраненную под каноническим URL. Просроченная ссылка
+// до ее пометки фоновой очисткой конфликтом не считается, вызывающий должен удерживать s.mu
+func (s *MemoryStore) existing(canonical string) (AddResult, bool) {
+	id, ok := s.byURL[canonical]
+	if !ok {
+		return AddResult{}, false
+	}
+
+	shard := s.shardByID(id)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+
+	u := shard.byID[id]
+	if u.Deleted || u.Expired(time.Now()) {
+		return AddResult{}, false
+	}
+	return u.result(), true
+}
+
+// insert добавляет запись во все индексы, вызывающий должен удерживать s.mu
+func (s *MemoryStore) insert(u URL) {
+	shard := s.shardByID(u.ID)
+	shard.mu.Lock()
+	shard.byID[u.ID] = u
+	shard.mu.Unlock()
+
+	users := s.shardByUser(u.UserID)
+	users.mu.Lock()
+	users.byUser[u.UserID] = append(users.byUser[u.UserID], u.ID)
+	users.mu.Unlock()
+
+	// Удаленная ссылка из журнала не занимает канонический URL
+	if !u.Deleted {
+		s.byURL[u.Canonical] = u.ID
+	}
+	s.ids = append(s.ids, u.ID)
+}
+
+// truncate откатывает записи, добавленные после первых n, вызывающий должен удерживать s.mu
+func (s *MemoryStore) truncate(n int) {
+	for _, id := range s.ids[n:] {
+		shard := s.shardByID(id)
+		shard.mu.Lock()
+		u := shard.byID[id]
+		delete(shard.byID, id)
+		shard.mu.Unlock()
+
+		users := s.shardByUser(u.UserID)
+		users.mu.Lock()
+		userIDs := users.byUser[u.UserID]
+		for i := len(userIDs) - 1; i >= 0; i-- {
+			if userIDs[i] == id {
+				userIDs = append(userIDs[:i], userIDs[i+1:]...)
+				break
+			}
+		}
+		if len(userIDs) == 0 {
+			delete(users.byUser, u.UserID)
+		} else {
+			users.byUser[u.UserID] = userIDs
+		}
+		users.mu.Unlock()
+
+		s.release(u)
+	}
+	s.ids = s.ids[:n]
+}
+
+// records возвращает записи начиная с n-й в порядке добавления, вызывающий должен удерживать s.mu
+func (s *MemoryStore) records(n int) []URL {
+	res := make([]URL, 0, len(s.ids)-n)
+	for _, id := range s.ids[n:] {
+		shard := s.shardByID(id)
+		shard.mu.RLock()
+		res = append(res, shard.byID[id])
+		shard.mu.RUnlock()
+	}
+	return res
+}
+
+func (s *MemoryStore) hasID(id string) bool {
+	shard := s.shardByID(id)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+
+	_, ok := shard.byID[id]
+	return ok
+}
+
+func (s *MemoryStore) AddURLwithTx(ctx context.Context, records []map[string]string, BaseURL string, userID string) ([]map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.addBatch(records, BaseURL, userID)
+}
+
+// addBatch добавляет пакет ссылок целиком либо не добавляет ничего, вызывающий должен удерживать s.mu
+func (s *MemoryStore) addBatch(records []map[string]string, BaseURL string, userID string) ([]map[string]string, error) {
+	ids := make(map[string]struct{}, len(records))
+	urls := make(map[string]struct{}, len(records))
+	expires := make([]*time.Time, len(records))
+	canonicals := make([]string, len(records))
+	var conflicts []URLConflict
+
+	// Проверяем весь пакет до изменения хранилища, как это делает транзакция в БД
+	for i, record := range records {
+		correlationID := record["correlation_id"]
+		originalURL := record["original_url"]
+
+		expiresAt, err := recordExpiresAt(record)
+		if err != nil {
+			return nil, err
+		}
+		expires[i] = expiresAt
+
+		if _, ok := ids[correlationID]; ok || s.hasID(correlationID) {
+			return nil, fmt.Errorf("id %q %w", correlationID, ErrConflict)
+		}
+		canonicals[i] = s.canon.Canonical(originalURL)
+		if _, ok := urls[canonicals[i]]; ok {
+			return nil, fmt.Errorf("url %q %w", originalURL, ErrConflict)
+		}
+		// Уже сохраненные URL собираем со всего пакета, чтобы вернуть клиенту каждую из ссылок
+		if existing, ok := s.existing(canonicals[i]); ok {
+			conflicts = append(conflicts, URLConflict{CorrelationID: correlationID, Existing: existing})
+		}
+		ids[correlationID] = struct{}{}
+		urls[canonicals[i]] = struct{}{}
+	}
+	if len(conflicts) > 0 {
+		return nil, &BatchConflictError{Conflicts: conflicts}
+	}
+
+	res := make([]map[string]string, 0, len(records))
+	now := time.Now()
+
+	for i, record := range records {
+		correlationID := record["correlation_id"]
+		s.insert(URL{ID: correlationID, URL: record["original_url"], Canonical: canonicals[i], UserID: userID, ExpiresAt: expires[i], CreatedAt: now})
+
+		// Добавляем результат в ответ
+		res = append(
+			res, map[string]string{
+				"correlation_id": correlationID,
+				"short_url":      fmt.Sprintf("%s/%s", BaseURL, correlationID),
+			},
+		)
+	}
+
+	return res, nil
+}
+
+func (s *MemoryStore) GetURL(ctx context.Context, id string) (string, error) {
+	shard := s.shardByID(id)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+
+	u, ok := shard.byID[id]
+	if !ok {
+		return "", ErrNotFound
+	}
+	// Просроченная ссылка ведет себя как удаленная до ее пометки фоновой очисткой
+	if u.Deleted || u.Expired(time.Now()) {
+		return "", ErrDeleted
+	}
+	return u.URL, nil
+}
+
+func (s *MemoryStore) GetURLOwner(ctx context.Context, id string) (string, error) {
+	shard := s.shardByID(id)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+
+	u, ok := shard.byID[id]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return u.UserID, nil
+}
+
+func (s *MemoryStore) GetURLsByUserID(ctx context.Context, userID string) ([]URL, error) {
+	users := s.shardByUser(userID)
+	users.mu.RLock()
+	ids := append([]string(nil), users.byUser[userID]...)
+	users.mu.RUnlock()
+
+	userURLs := make([]URL, 0, len(ids))
+	now := time.Now()
+
+	for _, id := range ids {
+		shard := s.shardByID(id)
+		shard.mu.RLock()
+		u, ok := shard.byID[id]
+		shard.mu.RUnlock()
+
+		if ok && !u.Deleted && !u.Expired(now) {
+			userURLs = append(userURLs, u)
+		}
+	}
+
+	return userURLs, nil
+}
+
+func (s *MemoryStore) AddAPIKey(ctx context.Context, key APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.addAPIKey(key)
+}
+
+// addAPIKey добавляет ключ доступа, вызывающий должен удерживать s.mu
+func (s *MemoryStore) addAPIKey(key APIKey) error {
+	s.keysMu.Lock()
+	defer s.keysMu.Unlock()
+
+	if _, ok := s.keysByID[key.ID]; ok {
+		return fmt.Errorf("api key id %q %w", key.ID, ErrConflict)
+	}
+	if _, ok := s.keysByHash[key.Hash]; ok {
+		return fmt.Errorf("api key hash %w", ErrConflict)
+	}
+
+	s.keysByHash[key.Hash] = key
+	s.keysByID[key.ID] = key.Hash
+	return nil
+}
+
+func (s *MemoryStore) GetAPIKeyByHash(ctx context.Context, hash string) (APIKey, error) {
+	s.keysMu.RLock()
+	defer s.keysMu.RUnlock()
+
+	key, ok := s.keysByHash[hash]
+	if !ok {
+		return APIKey{}, ErrNotFound
+	}
+	return key, nil
+}
+
+func (s *MemoryStore) GetAPIKeysByUserID(ctx context.Context, userID string) ([]APIKey, error) {
+	s.keysMu.RLock()
+	defer s.keysMu.RUnlock()
+
+	keys := make([]APIKey, 0)
+	for _, key := range s.keysByHash {
+		if key.UserID == userID {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(
+		keys, func(i, j int) bool {
+			return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+		},
+	)
+	return keys, nil
+}
+
+func (s *MemoryStore) DeleteAPIKey(ctx context.Context, id, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.deleteAPIKey(id, userID); !ok {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// deleteAPIKey удаляет ключ доступа пользователя и возвращает его, вызывающий должен удерживать s.mu
+func (s *MemoryStore) deleteAPIKey(id, userID string) (APIKey, bool) {
+	s.keysMu.Lock()
+	defer s.keysMu.Unlock()
+
+	hash, ok := s.keysByID[id]
+	key := s.keysByHash[hash]
+	if !ok || key.UserID != userID {
+		return APIKey{}, false
+	}
+
+	delete(s.keysByHash, hash)
+	delete(s.keysByID, id)
+	return key, true
+}
+
+// apiKeys возвращает все ключи доступа, вызывающий должен удерживать s.mu
+func (s *MemoryStore) apiKeys() []APIKey {
+	s.keysMu.RLock()
+	defer s.keysMu.RUnlock()
+
+	keys := make([]APIKey, 0, len(s.keysByHash))
+	for _, key := range s.keysByHash {
+		keys = append(keys, key)
+	}
+	return keys
+}
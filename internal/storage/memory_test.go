@@ -0,0 +1,191 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// newFilledMemoryStore создает хранилище с n ссылками, распределенными между 100 пользователями
+func newFilledMemoryStore(n int) (*MemoryStore, []string) {
+	store := NewMemoryStore(zap.NewNop())
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("%08x", i)
+		store.AddURL(context.Background(), ids[i], "http://example.com/"+ids[i], fmt.Sprintf("user%d", i%100), nil)
+	}
+	return store, ids
+}
+
+func TestMemoryStoreIndexes(t *testing.T) {
+	store, _ := newFilledMemoryStore(1000)
+
+	if res, err := store.AddURL(context.Background(), "new", "http://example.com/00000010", "user1", nil); !errors.Is(err, ErrConflict) || res.ID != "00000010" {
+		t.Errorf("duplicate URL added: %q, %v", res.ID, err)
+	}
+	if res, err := store.AddURL(context.Background(), "00000010", "http://example.com/new", "user1", nil); err != nil || res.ID == "00000010" {
+		t.Errorf("duplicate ID added: %q, %v", res.ID, err)
+	}
+	if urls, _ := store.GetURLsByUserID(context.Background(), "user10"); len(urls) != 10 {
+		t.Errorf("got %d URLs for user, want 10", len(urls))
+	}
+}
+
+// BenchmarkGetURL показывает, что время поиска ссылки не зависит от размера хранилища
+func BenchmarkGetURL(b *testing.B) {
+	for _, n := range []int{1000, 100000, 500000} {
+		store, ids := newFilledMemoryStore(n)
+		b.Run(
+			fmt.Sprintf("size=%d", n), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					store.GetURL(context.Background(), ids[i%n])
+				}
+			},
+		)
+	}
+}
+
+func BenchmarkGetURLParallel(b *testing.B) {
+	for _, n := range []int{1000, 500000} {
+		store, ids := newFilledMemoryStore(n)
+		b.Run(
+			fmt.Sprintf("size=%d", n), func(b *testing.B) {
+				b.RunParallel(
+					func(pb *testing.PB) {
+						i := 0
+						for pb.Next() {
+							store.GetURL(context.Background(), ids[i%n])
+							i++
+						}
+					},
+				)
+			},
+		)
+	}
+}
+
+func TestMemoryStoreExpiry(t *testing.T) {
+	store := NewMemoryStore(zap.NewNop())
+	now := time.Now()
+	past, future := now.Add(-time.Minute), now.Add(time.Hour)
+
+	store.AddURL(context.Background(), "old", "http://example.com/old", "user1", &past)
+	store.AddURL(context.Background(), "new", "http://example.com/new", "user1", &future)
+
+	if url, err := store.GetURL(context.Background(), "old"); !errors.Is(err, ErrDeleted) {
+		t.Errorf("expired URL resolved as: %q, %v", url, err)
+	}
+	if _, err := store.GetURL(context.Background(), "new"); err != nil {
+		t.Errorf("URL expired before its time")
+	}
+	if n, _ := store.DeleteExpiredURLs(context.Background(), now); n != 1 {
+		t.Errorf("got %d expired URLs, want 1", n)
+	}
+	if n, _ := store.DeleteExpiredURLs(context.Background(), now); n != 0 {
+		t.Errorf("expired URL deleted twice")
+	}
+}
+
+func TestMemoryStoreReleasesDeadURLs(t *testing.T) {
+	store := NewMemoryStore(zap.NewNop())
+	past := time.Now().Add(-time.Minute)
+
+	store.AddURL(context.Background(), "old", "http://example.com/a", "user1", &past)
+	store.AddURL(context.Background(), "gone", "http://example.com/b", "user1", nil)
+	store.DeleteURLs(context.Background(), []string{"gone"}, "user1")
+
+	// Просроченная ссылка освобождает URL еще до фоновой очистки, удаленная - сразу
+	for id, url := range map[string]string{"a1": "http://example.com/a", "b2": "http://example.com/b"} {
+		if res, err := store.AddURL(context.Background(), id, url, "user2", nil); err != nil || res.ID != id {
+			t.Errorf("URL %s not shortened again: %+v, %v", url, res, err)
+		}
+	}
+
+	// Очистка старой ссылки не должна освобождать URL, уже занятый новой
+	store.DeleteExpiredURLs(context.Background(), time.Now())
+	if res, err := store.AddURL(context.Background(), "c3", "http://example.com/a", "user2", nil); !errors.Is(err, ErrURLExists) || res.ID != "a1" {
+		t.Errorf("got %+v, %v, want conflict with a1", res, err)
+	}
+}
+
+func TestMemoryStoreURLOwner(t *testing.T) {
+	store := NewMemoryStore(zap.NewNop())
+	past := time.Now().Add(-time.Minute)
+
+	store.AddURL(context.Background(), "old", "http://example.com/a", "user1", &past)
+	store.AddURL(context.Background(), "gone", "http://example.com/b", "user1", nil)
+	store.DeleteURLs(context.Background(), []string{"gone"}, "user1")
+	store.DeleteExpiredURLs(context.Background(), time.Now())
+
+	// Владелец известен и у удаленных, и у просроченных ссылок
+	for _, id := range []string{"old", "gone"} {
+		if owner, err := store.GetURLOwner(context.Background(), id); err != nil || owner != "user1" {
+			t.Errorf("owner of %s: got %q, %v", id, owner, err)
+		}
+	}
+	if _, err := store.GetURLOwner(context.Background(), "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got %v, want ErrNotFound", err)
+	}
+}
+
+func TestMemoryStoreCanonicalDuplicates(t *testing.T) {
+	store := NewMemoryStore(zap.NewNop())
+
+	res, err := store.AddURL(context.Background(), "a1", "http://example.com", "user1", nil)
+	if err != nil || res.ID != "a1" {
+		t.Fatalf("URL not added: %q, %v", res.ID, err)
+	}
+
+	for _, url := range []string{"HTTP://Example.com/", "http://example.com/?", "http://example.com:80/?utm_source=mail"} {
+		if existing, err := store.AddURL(context.Background(), "b2", url, "user1", nil); !errors.Is(err, ErrURLExists) || existing.ID != "a1" {
+			t.Errorf("duplicate %q added as: %q, %v", url, existing.ID, err)
+		}
+	}
+
+	// Исходная строка сохраняется без изменений
+	if url, _ := store.GetURL(context.Background(), "a1"); url != "http://example.com" {
+		t.Errorf("original URL changed: %q", url)
+	}
+
+	if _, err := store.AddURLWithAlias(context.Background(), "sale", "http://EXAMPLE.com/", "user1", nil); err != ErrURLExists {
+		t.Errorf("duplicate alias URL accepted: %v", err)
+	}
+}
+
+func TestMemoryStoreConflictDetails(t *testing.T) {
+	store := NewMemoryStore(zap.NewNop())
+
+	created, err := store.AddURL(context.Background(), "a1", "http://example.com", "user1", nil)
+	if err != nil || created.UserID != "user1" || created.CreatedAt.IsZero() {
+		t.Fatalf("URL not added: %+v, %v", created, err)
+	}
+
+	// При конфликте возвращается сохраненная ссылка с ее владельцем и моментом создания
+	existing, err := store.AddURL(context.Background(), "b2", "http://example.com/", "user2", nil)
+	if !errors.Is(err, ErrURLExists) || existing != created {
+		t.Errorf("got %+v, %v, want %+v", existing, err, created)
+	}
+
+	// Пакет отклоняется целиком, в ошибке перечислены все уже сохраненные URL
+	records := []map[string]string{
+		{"correlation_id": "c3", "original_url": "http://example.com"},
+		{"correlation_id": "d4", "original_url": "http://other.example.com"},
+	}
+	_, err = store.AddURLwithTx(context.Background(), records, "http://localhost:8080", "user2")
+	var conflictErr *BatchConflictError
+	if !errors.As(err, &conflictErr) || !errors.Is(err, ErrConflict) {
+		t.Fatalf("got %v, want *BatchConflictError", err)
+	}
+	want := []URLConflict{{CorrelationID: "c3", Existing: created}}
+	if !reflect.DeepEqual(conflictErr.Conflicts, want) {
+		t.Errorf("got conflicts %+v, want %+v", conflictErr.Conflicts, want)
+	}
+	if _, err = store.GetURL(context.Background(), "d4"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("rejected batch was partially saved")
+	}
+}
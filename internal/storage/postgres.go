@@ -0,0 +1,623 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/egosha7/shortlink/internal/helpers"
+	"github.com/egosha7/shortlink/internal/urlcanon"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"go.uber.org/zap"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PostgresURLRepository - хранилище ссылок в Postgres, все запросы выполняются через пул подключений
+type PostgresURLRepository struct {
+	logger *zap.Logger
+	pool   *pgxpool.Pool
+	canon  urlcanon.Options
+}
+
+func NewPostgresURLRepository(pool *pgxpool.Pool, logger *zap.Logger) *PostgresURLRepository {
+	return &PostgresURLRepository{
+		logger: logger,
+		pool:   pool,
+		canon:  urlcanon.Default(),
+	}
+}
+
+// BackfillCanonical пересчитывает канонический вид URL действующих ссылок, если он еще не заполнен
+// или заполнен с другими настройками приведения, как это делает файловое хранилище при загрузке.
+// Настройки, с которыми выполнен пересчет, сохраняются в canonical_state, поэтому при следующих
+// запусках он пропускается. Из ссылок с совпавшим каноническим видом его получает сохраненная раньше,
+// остальные остаются без него
+func (r *PostgresURLRepository) BackfillCanonical(ctx context.Context) error {
+	options := fmt.Sprintf("%+v", r.canon)
+	return r.pool.BeginFunc(
+		ctx, func(tx pgx.Tx) error {
+			// Экземпляры сервиса, запущенные одновременно, выполняют пересчет по очереди
+			if _, err := tx.Exec(ctx, "LOCK TABLE canonical_state IN EXCLUSIVE MODE"); err != nil {
+				return err
+			}
+			var done string
+			err := tx.QueryRow(ctx, "SELECT options FROM canonical_state").Scan(&done)
+			if err == nil && done == options {
+				return nil
+			}
+			if err != nil && err != pgx.ErrNoRows {
+				return err
+			}
+
+			// Удаленным и просроченным ссылкам канонический вид не нужен, его освобождает releaseCanonical
+			query := `
+				SELECT u.id, u.url
+				FROM urls u
+				JOIN user_urls uu ON u.ID = uu.IDshortURL
+				WHERE uu.delFLAG = false AND (u.expires_at IS NULL OR u.expires_at > now())
+				ORDER BY uu.ID`
+			rows, err := tx.Query(ctx, query)
+			if err != nil {
+				return err
+			}
+			batch := &pgx.Batch{}
+			seen := make(map[string]string)
+			for rows.Next() {
+				var id, url string
+				if err = rows.Scan(&id, &url); err != nil {
+					rows.Close()
+					return err
+				}
+				canonical := r.canon.Canonical(url)
+				if first, ok := seen[canonical]; ok {
+					r.logger.Warn(
+						"Duplicate canonical URL, skipping",
+						zap.String("id", id), zap.String("url", url), zap.String("existing_id", first),
+					)
+					continue
+				}
+				seen[canonical] = id
+				batch.Queue("UPDATE urls SET canonical_url = $1 WHERE id = $2", canonical, id)
+			}
+			rows.Close()
+			if err = rows.Err(); err != nil {
+				return err
+			}
+
+			// Сбрасываем прежние значения, чтобы новые не столкнулись с ними в уникальном индексе
+			if _, err = tx.Exec(ctx, "UPDATE urls SET canonical_url = NULL WHERE canonical_url IS NOT NULL"); err != nil {
+				return err
+			}
+			results := tx.SendBatch(ctx, batch)
+			for i := 0; i < batch.Len(); i++ {
+				if _, err = results.Exec(); err != nil {
+					results.Close()
+					return err
+				}
+			}
+			if err = results.Close(); err != nil {
+				return err
+			}
+
+			if _, err = tx.Exec(ctx, "DELETE FROM canonical_state"); err != nil {
+				return err
+			}
+			if _, err = tx.Exec(ctx, "INSERT INTO canonical_state (options) VALUES ($1)", options); err != nil {
+				return err
+			}
+			r.logger.Info("Canonical URLs recomputed", zap.Int("count", len(seen)), zap.String("options", options))
+			return nil
+		},
+	)
+}
+
+func (r *PostgresURLRepository) DeleteURLs(ctx context.Context, urls []string, userID string) error {
+	query := `
+		UPDATE user_urls
+		SET delFLAG = true
+		WHERE userID = $1 AND IDshortURL IN (`
+
+	// Создаем плейсхолдеры для каждой ссылки
+	placeholders := make([]string, len(urls))
+	params := make([]interface{}, len(urls)+1) // +1 для учета userID в качестве первого параметра
+	params[0] = userID
+
+	for i, url := range urls {
+		placeholders[i] = "$" + strconv.Itoa(i+2) // +2 для учета userID в качестве первого плейсхолдера
+		params[i+1] = url
+	}
+
+	query += strings.Join(placeholders, ", ") + ")"
+
+	// Выполняем запрос на удаление всех ссылок одним запросом
+	if _, err := r.pool.Exec(ctx, query, params...); err != nil {
+		return unavailable(err)
+	}
+	return nil
+}
+
+// DeleteURLsBatch помечает удаленными ссылки нескольких пользователей одним запросом,
+// пары (ID, пользователь) передаются двумя массивами одинаковой длины
+func (r *PostgresURLRepository) DeleteURLsBatch(ctx context.Context, deletions []Deletion) error {
+	ids := make([]string, len(deletions))
+	userIDs := make([]string, len(deletions))
+	for i, d := range deletions {
+		ids[i] = d.ID
+		userIDs[i] = d.UserID
+	}
+
+	query := `
+		UPDATE user_urls u
+		SET delFLAG = true
+		FROM unnest($1::text[], $2::text[]) AS d(id, user_id)
+		WHERE u.IDshortURL = ANY($1) AND u.IDshortURL = d.id AND u.userID = d.user_id`
+
+	if _, err := r.pool.Exec(ctx, query, ids, userIDs); err != nil {
+		return unavailable(err)
+	}
+	return nil
+}
+
+// dbError сопоставляет ошибку БД с ошибками хранилища: нарушение уникальности - ErrConflict,
+// остальные ошибки означают, что БД не смогла обслужить запрос
+func dbError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+		return fmt.Errorf("%w: %w", ErrConflict, err)
+	}
+	return unavailable(err)
+}
+
+// IsRetryable сообщает, имеет ли смысл повторить операцию после ошибки БД:
+// обрыв соединения, таймаут, конфликт транзакций или нехватка ресурсов сервера
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if pgconn.Timeout(err) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgerrcode.IsConnectionException(pgErr.Code) ||
+			pgerrcode.IsTransactionRollback(pgErr.Code) ||
+			pgerrcode.IsInsufficientResources(pgErr.Code) ||
+			pgErr.Code == pgerrcode.AdminShutdown ||
+			pgErr.Code == pgerrcode.CannotConnectNow
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// Ping проверяет доступность БД через пул подключений
+func (r *PostgresURLRepository) Ping(ctx context.Context) error {
+	return r.pool.Ping(ctx)
+}
+
+// Close ничего не делает, пул закрывает его владелец
+func (r *PostgresURLRepository) Close() error {
+	return nil
+}
+
+func (r *PostgresURLRepository) DeleteExpiredURLs(ctx context.Context, now time.Time) (int, error) {
+	query := `
+		UPDATE user_urls uu
+		SET delFLAG = true
+		FROM urls u
+		WHERE u.ID = uu.IDshortURL AND uu.delFLAG = false AND u.expires_at <= $1
+	`
+	tag, err := r.pool.Exec(ctx, query, now)
+	if err != nil {
+		return 0, unavailable(err)
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+func (r *PostgresURLRepository) AddURL(ctx context.Context, id string, url string, userID string, expiresAt *time.Time) (AddResult, error) {
+	// При совпадении ID генерируем новый, но не более 10 раз
+	for attempts := 10; ; attempts-- {
+		createdAt, err := r.insertURL(ctx, id, url, userID, expiresAt)
+		if err == nil {
+			return AddResult{ID: id, UserID: userID, CreatedAt: createdAt}, nil
+		}
+
+		var pgErr *pgconn.PgError
+		if !errors.As(err, &pgErr) || pgErr.Code != pgerrcode.UniqueViolation {
+			return AddResult{}, unavailable(err)
+		}
+
+		switch pgErr.ConstraintName {
+		case "urls_pkey":
+			// ID уже существует в базе данных, генерируем новый
+			if attempts > 0 {
+				id = helpers.GenerateID(6)
+				continue
+			}
+			return AddResult{}, fmt.Errorf("exceeded maximum retry attempts: %w", dbError(err))
+		case "urls_canonical_url_key":
+			// URL уже существует в базе данных, возвращаем соответствующий ID
+			res, err := r.existing(ctx, url)
+			if errors.Is(err, errExistingGone) && attempts > 0 {
+				continue
+			}
+			return res, err
+		default:
+			return AddResult{}, dbError(err)
+		}
+	}
+}
+
+// errExistingGone - ссылку с тем же URL удалили между вставкой и поиском. Вставку стоит
+// повторить: теперь URL освободится, а ответ 404 на запрос создания ссылки бессмыслен
+var errExistingGone = unavailable(errors.New("existing link was deleted concurrently"))
+
+// existing возвращает ссылку, сохраненную под тем же каноническим URL, вместе с ErrURLExists
+func (r *PostgresURLRepository) existing(ctx context.Context, url string) (AddResult, error) {
+	canonical := r.canon.Canonical(url)
+	found, err := r.findExisting(ctx, r.pool, []string{canonical})
+	if err != nil {
+		return AddResult{}, unavailable(err)
+	}
+	res, ok := found[canonical]
+	if !ok {
+		return AddResult{}, errExistingGone
+	}
+	return res, ErrURLExists
+}
+
+// querier - общий интерфейс пула и транзакции для запросов, которые выполняются в обоих
+type querier interface {
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+}
+
+// findExisting возвращает действующие ссылки по их каноническим URL
+func (r *PostgresURLRepository) findExisting(ctx context.Context, q querier, canonicals []string) (map[string]AddResult, error) {
+	query := `
+		SELECT u.canonical_url, u.id, uu.userid, u.created_at
+		FROM urls u
+		JOIN user_urls uu ON u.ID = uu.IDshortURL
+		WHERE u.canonical_url = ANY($1) AND uu.delFLAG = false
+		  AND (u.expires_at IS NULL OR u.expires_at > now())`
+	rows, err := q.Query(ctx, query, canonicals)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	found := make(map[string]AddResult)
+	for rows.Next() {
+		var canonical string
+		var res AddResult
+		var createdAt *time.Time
+		if err = rows.Scan(&canonical, &res.ID, &res.UserID, &createdAt); err != nil {
+			return nil, err
+		}
+		// У записей, сохраненных до появления created_at, момент создания неизвестен
+		if createdAt != nil {
+			res.CreatedAt = *createdAt
+		}
+		found[canonical] = res
+	}
+	return found, rows.Err()
+}
+
+// releaseCanonical освобождает канонические URL удаленных и просроченных ссылок, чтобы их можно
+// было сократить снова. Частичный уникальный индекс здесь не подходит: срок жизни зависит от now(),
+// а признак удаления хранится в user_urls. Выполняется в транзакции вставки, до фоновой очистки
+func releaseCanonical(ctx context.Context, tx pgx.Tx, canonicals []string) error {
+	query := `
+		UPDATE urls u
+		SET canonical_url = NULL
+		FROM user_urls uu
+		WHERE u.ID = uu.IDshortURL AND u.canonical_url = ANY($1)
+		  AND (uu.delFLAG = true OR u.expires_at <= now())`
+	_, err := tx.Exec(ctx, query, canonicals)
+	return err
+}
+
+// insertURL сохраняет ссылку и ее владельца в одной транзакции и возвращает момент создания
+func (r *PostgresURLRepository) insertURL(ctx context.Context, id, url, userID string, expiresAt *time.Time) (time.Time, error) {
+	var createdAt time.Time
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return createdAt, err
+	}
+	defer tx.Rollback(ctx)
+
+	canonical := r.canon.Canonical(url)
+	if err = releaseCanonical(ctx, tx, []string{canonical}); err != nil {
+		return createdAt, err
+	}
+
+	err = tx.QueryRow(
+		ctx, "INSERT INTO urls (id, url, canonical_url, expires_at) VALUES ($1, $2, $3, $4) RETURNING created_at",
+		id, url, canonical, expiresAt,
+	).Scan(&createdAt)
+	if err != nil {
+		return createdAt, err
+	}
+
+	// Добавляем данные в таблицу user_urls
+	_, err = tx.Exec(ctx, "INSERT INTO user_urls (idshorturl, userid) VALUES ($1, $2)", id, userID)
+	if err != nil {
+		return createdAt, err
+	}
+
+	return createdAt, tx.Commit(ctx)
+}
+
+func (r *PostgresURLRepository) AddURLWithAlias(ctx context.Context, alias string, url string, userID string, expiresAt *time.Time) (AddResult, error) {
+	for attempts := 10; ; attempts-- {
+		createdAt, err := r.insertURL(ctx, alias, url, userID, expiresAt)
+		if err == nil {
+			return AddResult{ID: alias, UserID: userID, CreatedAt: createdAt}, nil
+		}
+
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+			switch pgErr.ConstraintName {
+			case "urls_pkey":
+				return AddResult{}, ErrAliasExists
+			case "urls_canonical_url_key":
+				// URL уже существует в базе данных, возвращаем соответствующий ID
+				res, err := r.existing(ctx, url)
+				if errors.Is(err, errExistingGone) && attempts > 0 {
+					continue
+				}
+				return res, err
+			}
+		}
+		return AddResult{}, dbError(err)
+	}
+}
+
+// AddURLwithTx сохраняет пакет ссылок в одной транзакции: вставки отправляются одним
+// пакетом запросов, при ошибке любой из них пакет откатывается целиком
+func (r *PostgresURLRepository) AddURLwithTx(ctx context.Context, records []map[string]string, BaseURL string, userID string) ([]map[string]string, error) {
+	batch := &pgx.Batch{}
+	res := make([]map[string]string, 0, len(records))
+	canonicals := make([]string, len(records))
+
+	// Обрабатываем каждую запись
+	for i, record := range records {
+		correlationID := record["correlation_id"]
+		originalURL := record["original_url"]
+
+		expiresAt, err := recordExpiresAt(record)
+		if err != nil {
+			return nil, err
+		}
+
+		canonicals[i] = r.canon.Canonical(originalURL)
+		batch.Queue(
+			"INSERT INTO urls (id, url, canonical_url, expires_at) VALUES ($1, $2, $3, $4)",
+			correlationID, originalURL, canonicals[i], expiresAt,
+		)
+		batch.Queue("INSERT INTO user_urls (idshorturl, userid) VALUES ($1, $2)", correlationID, userID)
+
+		shortURL := fmt.Sprintf("%s/%s", BaseURL, correlationID)
+
+		// Добавляем результат в ответ
+		res = append(
+			res, map[string]string{
+				"correlation_id": correlationID,
+				"short_url":      shortURL,
+			},
+		)
+	}
+
+	var conflictErr *BatchConflictError
+	err := r.pool.BeginFunc(
+		ctx, func(tx pgx.Tx) error {
+			if err := releaseCanonical(ctx, tx, canonicals); err != nil {
+				return err
+			}
+
+			// Уже сохраненные URL ищем заранее, чтобы вернуть клиенту каждую из ссылок,
+			// а не только первую, на которой оборвалась бы вставка
+			existing, err := r.findExisting(ctx, tx, canonicals)
+			if err != nil {
+				return err
+			}
+			for i, record := range records {
+				if found, ok := existing[canonicals[i]]; ok {
+					if conflictErr == nil {
+						conflictErr = &BatchConflictError{}
+					}
+					conflictErr.Conflicts = append(
+						conflictErr.Conflicts, URLConflict{CorrelationID: record["correlation_id"], Existing: found},
+					)
+				}
+			}
+			if conflictErr != nil {
+				return conflictErr
+			}
+
+			results := tx.SendBatch(ctx, batch)
+			for i := 0; i < batch.Len(); i++ {
+				if _, err := results.Exec(); err != nil {
+					results.Close()
+					return err
+				}
+			}
+			return results.Close()
+		},
+	)
+	if conflictErr != nil {
+		return nil, conflictErr
+	}
+	if err != nil {
+		return nil, dbError(err)
+	}
+	return res, nil
+}
+
+// GetIDByURL ищет ссылку по каноническому виду URL
+func (r *PostgresURLRepository) GetIDByURL(ctx context.Context, url string) (string, error) {
+	var id string
+	query := "SELECT id FROM urls WHERE canonical_url = $1"
+	err := r.pool.QueryRow(ctx, query, r.canon.Canonical(url)).Scan(&id)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return "", ErrNotFound
+		}
+		return "", unavailable(err)
+	}
+	return id, nil
+}
+
+func (r *PostgresURLRepository) GetURL(ctx context.Context, id string) (string, error) {
+	var url string
+	var expiresAt *time.Time
+	var delFlag bool
+	query := `
+		SELECT u.url, u.expires_at, uu.delFLAG
+		FROM urls u
+		JOIN user_urls uu ON u.ID = uu.IDshortURL
+		WHERE u.id = $1`
+	err := r.pool.QueryRow(ctx, query, id).Scan(&url, &expiresAt, &delFlag)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return "", ErrNotFound
+		}
+		return "", unavailable(err)
+	}
+
+	// Просроченная ссылка ведет себя как удаленная до ее пометки фоновой очисткой
+	if delFlag || (URL{ExpiresAt: expiresAt}).Expired(time.Now()) {
+		return "", ErrDeleted
+	}
+	return url, nil
+}
+
+func (r *PostgresURLRepository) GetURLOwner(ctx context.Context, id string) (string, error) {
+	var userID string
+	err := r.pool.QueryRow(ctx, `SELECT userID FROM user_urls WHERE IDshortURL = $1`, id).Scan(&userID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return "", ErrNotFound
+		}
+		return "", unavailable(err)
+	}
+	return userID, nil
+}
+
+func (r *PostgresURLRepository) GetURLsByUserID(ctx context.Context, userID string) ([]URL, error) {
+	var userURLs []URL
+	query := `
+        SELECT u.URL, uu.IDshortURL
+        FROM urls u
+        JOIN user_urls uu ON u.ID = uu.IDshortURL
+        WHERE uu.userID = $1 AND uu.delFLAG = false
+          AND (u.expires_at IS NULL OR u.expires_at > now())
+    `
+	rows, err := r.pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, unavailable(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var url, shortURL string
+		err := rows.Scan(&url, &shortURL)
+		if err != nil {
+			return nil, unavailable(err)
+		}
+		userURLs = append(userURLs, URL{ID: shortURL, URL: url, UserID: userID})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, unavailable(err)
+	}
+
+	return userURLs, nil
+}
+
+func (r *PostgresURLRepository) PrintAllURLs() {
+	rows, err := r.pool.Query(context.Background(), "SELECT id, url FROM urls")
+	if err != nil {
+		r.logger.Error("Failed to query URLs", zap.Error(err))
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, url string
+		err := rows.Scan(&id, &url)
+		if err != nil {
+			r.logger.Error("Failed to scan row", zap.Error(err))
+			continue
+		}
+		r.logger.Info(
+			"URL",
+			zap.String("ID", id),
+			zap.String("URL", url),
+		)
+	}
+
+	if err := rows.Err(); err != nil {
+		r.logger.Error("Error iterating over rows", zap.Error(err))
+	}
+}
+
+func (r *PostgresURLRepository) AddAPIKey(ctx context.Context, key APIKey) error {
+	query := "INSERT INTO api_keys (id, userid, name, key_hash, scopes, created_at) VALUES ($1, $2, $3, $4, $5, $6)"
+	if _, err := r.pool.Exec(ctx, query, key.ID, key.UserID, key.Name, key.Hash, key.Scopes, key.CreatedAt); err != nil {
+		return dbError(err)
+	}
+	return nil
+}
+
+func (r *PostgresURLRepository) GetAPIKeyByHash(ctx context.Context, hash string) (APIKey, error) {
+	key := APIKey{Hash: hash}
+	query := "SELECT id, userid, name, scopes, created_at FROM api_keys WHERE key_hash = $1"
+	err := r.pool.QueryRow(ctx, query, hash).Scan(&key.ID, &key.UserID, &key.Name, &key.Scopes, &key.CreatedAt)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return APIKey{}, ErrNotFound
+		}
+		return APIKey{}, unavailable(err)
+	}
+	return key, nil
+}
+
+func (r *PostgresURLRepository) GetAPIKeysByUserID(ctx context.Context, userID string) ([]APIKey, error) {
+	query := "SELECT id, name, key_hash, scopes, created_at FROM api_keys WHERE userid = $1 ORDER BY created_at"
+	rows, err := r.pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, unavailable(err)
+	}
+	defer rows.Close()
+
+	keys := make([]APIKey, 0)
+	for rows.Next() {
+		key := APIKey{UserID: userID}
+		if err := rows.Scan(&key.ID, &key.Name, &key.Hash, &key.Scopes, &key.CreatedAt); err != nil {
+			return nil, unavailable(err)
+		}
+		keys = append(keys, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, unavailable(err)
+	}
+	return keys, nil
+}
+
+func (r *PostgresURLRepository) DeleteAPIKey(ctx context.Context, id, userID string) error {
+	tag, err := r.pool.Exec(ctx, "DELETE FROM api_keys WHERE id = $1 AND userid = $2", id, userID)
+	if err != nil {
+		return unavailable(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
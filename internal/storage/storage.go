@@ -2,519 +2,221 @@ package storage
 
 import (
 	"context"
-	"database/sql"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/egosha7/shortlink/internal/helpers"
-	"github.com/jackc/pgconn"
-	"github.com/jackc/pgerrcode"
-	"github.com/jackc/pgx/v4"
+	"github.com/egosha7/shortlink/internal/config"
+	"github.com/egosha7/shortlink/internal/migrations"
+	"github.com/egosha7/shortlink/internal/urlcanon"
 	"github.com/jackc/pgx/v4/pgxpool"
-	_ "github.com/jackc/pgx/v4/stdlib"
 	"go.uber.org/zap"
-	"os"
-	"strconv"
-	"strings"
-	"sync"
+	"time"
 )
 
-type URLStore struct {
-	urls     []URL
-	mu       sync.RWMutex
-	filePath string
-	DBstring string
-	db       *pgx.Conn
-	logger   *zap.Logger
-	pool     *pgxpool.Pool
-}
+// Ошибки хранилища, обработчики сопоставляют их с кодами ответа
+var (
+	ErrNotFound    = errors.New("not found")
+	ErrConflict    = errors.New("already exists")
+	ErrDeleted     = errors.New("deleted")
+	ErrUnavailable = errors.New("storage unavailable")
+)
 
-type URL struct {
-	ID     string
-	URL    string
-	UserID string
-}
+// Конфликты при добавлении ссылки, errors.Is сопоставляет их с ErrConflict
+var (
+	ErrAliasExists = fmt.Errorf("alias %w", ErrConflict)
+	ErrURLExists   = fmt.Errorf("url %w", ErrConflict)
+)
 
-func NewURLStore(filePath string, DBstring string, db *pgx.Conn, logger *zap.Logger, pool *pgxpool.Pool) *URLStore {
-	return &URLStore{
-		urls:     make([]URL, 0),
-		filePath: filePath,
-		DBstring: DBstring,
-		db:       db,
-		logger:   logger,
-		pool:     pool,
-	}
+// unavailable - функция для оборачивания ошибки ввода-вывода в ErrUnavailable с сохранением исходной
+func unavailable(err error) error {
+	return fmt.Errorf("%w: %w", ErrUnavailable, err)
 }
 
-func (s *URLStore) DeleteURLs(urls []string, userID string) {
-	if s.DBstring != "" {
-		repo := NewPostgresURLRepository(s.db, s.logger, s.pool)
-		repo.DeleteURLs(urls, userID)
-	}
-	s.logger.Error("Database string no exist")
+// AddResult - результат добавления ссылки: сохраненная ссылка, а при ErrURLExists - уже существующая
+type AddResult struct {
+	ID        string
+	UserID    string    // Владелец ссылки
+	CreatedAt time.Time // Момент создания, нулевое значение у записей, сохраненных до его появления
 }
 
-func (s *URLStore) AddURL(id, url, userID string) (string, bool) {
-	if s.DBstring != "" {
-		repo := NewPostgresURLRepository(s.db, s.logger, s.pool)
-		return repo.AddURL(id, url, userID)
-	}
-
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	// Проверка наличия дубликата ID
-	for _, u := range s.urls {
-		if u.ID == id {
-			// ID уже существует в хранилище, генерируем новый
-			newID := helpers.GenerateID(6)
-			return s.AddURL(newID, url, userID)
-		}
-	}
-
-	// Проверка наличия дубликата URL
-	for _, u := range s.urls {
-		if u.URL == url {
-			// URL уже существует в хранилище, возвращаем соответствующий ID
-			return u.ID, false
-		}
-	}
-
-	newURL := URL{ID: id, URL: url, UserID: userID}
-	s.urls = append(s.urls, newURL)
-
-	// Сохранение данных в файл
-	err := s.SaveToFile()
-	if err != nil {
-		s.logger.Error("Error saving data to file", zap.Error(err))
-	}
-
-	return id, true
+// URLConflict - запись пакета, URL которой уже сохранен
+type URLConflict struct {
+	CorrelationID string
+	Existing      AddResult
 }
 
-func (s *URLStore) AddURLwithTx(records []map[string]string, ctx context.Context, BaseURL string, userID string) ([]map[string]string, bool) {
-	if s.DBstring != "" {
-		repo := NewPostgresURLRepository(s.db, s.logger, s.pool)
-		return repo.AddURLwithTx(records, ctx, s.DBstring, BaseURL, userID)
-	}
-	s.logger.Error("Database string no exist")
-	return nil, false
+// BatchConflictError - пакет отклонен целиком, так как часть его URL уже сохранена.
+// errors.Is сопоставляет ошибку с ErrURLExists и ErrConflict
+type BatchConflictError struct {
+	Conflicts []URLConflict
 }
 
-func (s *URLStore) GetURL(id string) (string, bool) {
-	if s.DBstring != "" {
-		repo := NewPostgresURLRepository(s.db, s.logger, s.pool)
-		return repo.GetURLByID(id, s.DBstring)
-	}
-
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	for _, u := range s.urls {
-		if u.ID == id {
-			return u.URL, true
-		}
-	}
-	return "", false
+func (e *BatchConflictError) Error() string {
+	return fmt.Sprintf("batch: %d %s", len(e.Conflicts), ErrURLExists)
 }
 
-func (s *URLStore) GetURLsByUserID(userID string) []URL {
-	if s.DBstring != "" {
-		repo := NewPostgresURLRepository(s.db, s.logger, s.pool)
-		return repo.GetURLsByUserID(userID)
-	}
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	userURLs := make([]URL, 0)
-
-	for _, u := range s.urls {
-		if u.UserID == userID {
-			userURLs = append(userURLs, u)
-		}
-	}
-
-	return userURLs
+func (e *BatchConflictError) Unwrap() error {
+	return ErrURLExists
 }
 
-func (s *URLStore) LoadFromFile() error {
-	// Проверка наличия флага или переменной окружения
-	if s.filePath == "" {
-		return nil // Если значение не установлено, выходим без загрузки данных
-	}
-
-	// Проверка существования файла
-	if _, err := os.Stat(s.filePath); os.IsNotExist(err) {
-		// Создание нового файла
-		file, err := os.Create(s.filePath)
-		if err != nil {
-			return err
-		}
-		defer file.Close()
-	}
-
-	// Открываем файл
-	file, err := os.OpenFile(s.filePath, os.O_RDWR|os.O_CREATE, 0666)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	// Читаем данные из файла
-	fileInfo, err := file.Stat()
-	if err != nil {
-		return err
-	}
-
-	if fileInfo.Size() == 0 {
-		return nil
-	}
-
-	if err = json.NewDecoder(file).Decode(&s.urls); err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func (s *URLStore) SaveToFile() error {
-	// Проверка наличия флага или переменной окружения
-	if s.filePath == "" {
-		return nil // Если значение не установлено, выходим без сохранения на диск
-	}
-
-	file, err := os.Create(s.filePath)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	err = json.NewEncoder(file).Encode(s.urls)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-type URLRepository interface {
-	AddURL(id string, url string) (string, bool)
-	GetIDByURL(url string) (string, bool)
-	GetURLByID(id string) (string, bool)
-	CreateTable()
-	PrintAllURLs()
+// Deletion - ссылка, которую пользователь попросил удалить
+type Deletion struct {
+	ID     string
+	UserID string
 }
 
-type PostgresURLRepository struct {
-	db     *pgx.Conn
-	logger *zap.Logger
-	pool   *pgxpool.Pool
+// groupDeletions группирует ссылки по пользователям в порядке их появления
+func groupDeletions(deletions []Deletion) ([]string, map[string][]string) {
+	var users []string
+	byUser := make(map[string][]string)
+	for _, d := range deletions {
+		if _, ok := byUser[d.UserID]; !ok {
+			users = append(users, d.UserID)
+		}
+		byUser[d.UserID] = append(byUser[d.UserID], d.ID)
+	}
+	return users, byUser
+}
+
+// Storage - интерфейс хранилища сокращенных ссылок. Методы возвращают ErrNotFound,
+// ErrConflict, ErrDeleted или ErrUnavailable, исходная ошибка доступна через errors.Is и errors.As
+type Storage interface {
+	// AddURL и AddURLWithAlias принимают необязательный срок жизни ссылки expiresAt.
+	// При совпадении URL с сохраненным возвращают ErrURLExists и ID сохраненной ссылки
+	AddURL(ctx context.Context, id, url, userID string, expiresAt *time.Time) (AddResult, error)
+	// AddURLWithAlias сохраняет ссылку под заданным ID без генерации нового,
+	// занятый ID возвращает ErrAliasExists
+	AddURLWithAlias(ctx context.Context, alias, url, userID string, expiresAt *time.Time) (AddResult, error)
+	// AddURLwithTx берет срок жизни из поля expires_at записи в формате RFC 3339.
+	// Если часть URL пакета уже сохранена, возвращает *BatchConflictError с этими ссылками
+	AddURLwithTx(ctx context.Context, records []map[string]string, BaseURL string, userID string) ([]map[string]string, error)
+	// GetURL возвращает ErrDeleted для удаленной или просроченной ссылки
+	GetURL(ctx context.Context, id string) (string, error)
+	GetURLsByUserID(ctx context.Context, userID string) ([]URL, error)
+	// GetURLOwner возвращает владельца ссылки, в том числе удаленной или просроченной
+	GetURLOwner(ctx context.Context, id string) (string, error)
+	DeleteURLs(ctx context.Context, urls []string, userID string) error
+	// DeleteURLsBatch помечает удаленными ссылки нескольких пользователей за одну операцию
+	DeleteURLsBatch(ctx context.Context, deletions []Deletion) error
+	// DeleteExpiredURLs помечает удаленными ссылки с истекшим сроком жизни и возвращает их количество
+	DeleteExpiredURLs(ctx context.Context, now time.Time) (int, error)
+	// Ping проверяет, что хранилище способно обслуживать запросы
+	Ping(ctx context.Context) error
+	// Close сохраняет несохраненные данные и освобождает ресурсы хранилища
+	Close() error
+
+	APIKeyStorage
 }
 
-func NewPostgresURLRepository(db *pgx.Conn, logger *zap.Logger, pool *pgxpool.Pool) *PostgresURLRepository {
-	return &PostgresURLRepository{
-		db:     db,
-		logger: logger,
-		pool:   pool,
-	}
+type URL struct {
+	ID        string
+	URL       string
+	Canonical string `json:",omitempty"` // Канонический вид URL, по нему ищутся дубликаты
+	UserID    string
+	Deleted   bool       // Признак мягкого удаления, аналог delFLAG в БД
+	ExpiresAt *time.Time `json:",omitempty"` // Срок жизни ссылки, nil - бессрочная
+	CreatedAt time.Time  // Момент создания, нулевое значение у записей старого формата
 }
 
-func (r *PostgresURLRepository) DeleteURLs(urls []string, userID string) {
-	// Использование пула подключений для выполнения запросов
-	conn, err := r.pool.Acquire(context.Background())
-	if err != nil {
-		r.logger.Error("Error open connection", zap.Error(err))
-		return
-	}
-	defer conn.Release()
-
-	query := `
-		UPDATE user_urls
-		SET delFLAG = true
-		WHERE userID = $1 AND IDshortURL IN (`
-
-	// Создаем плейсхолдеры для каждой ссылки
-	placeholders := make([]string, len(urls))
-	params := make([]interface{}, len(urls)+1) // +1 для учета userID в качестве первого параметра
-	params[0] = userID
-
-	for i, url := range urls {
-		placeholders[i] = "$" + strconv.Itoa(i+2) // +2 для учета userID в качестве первого плейсхолдера
-		params[i+1] = url
-	}
-
-	query += strings.Join(placeholders, ", ") + ")"
-
-	// Выполняем запрос на удаление всех ссылок одним запросом
-	_, err = conn.Exec(context.Background(), query, params...)
-	if err != nil {
-		r.logger.Error("Error request to DB", zap.Error(err))
-		return
-	}
+// result описывает сохраненную ссылку для AddResult
+func (u URL) result() AddResult {
+	return AddResult{ID: u.ID, UserID: u.UserID, CreatedAt: u.CreatedAt}
 }
 
-func (r *PostgresURLRepository) AddURL(id string, url string, userID string) (string, bool) {
-	return r.addURLWithRetry(id, url, userID, 10)
+// Expired сообщает, истек ли срок жизни ссылки к моменту now
+func (u URL) Expired(now time.Time) bool {
+	return u.ExpiresAt != nil && !u.ExpiresAt.After(now)
 }
 
-func (r *PostgresURLRepository) addURLWithRetry(id string, url string, userID string, attempts int) (string, bool) {
-
-	// Использование пула подключений для выполнения запросов
-	conn, err := r.pool.Acquire(context.Background())
-	if err != nil {
-		r.logger.Error("Error open connection", zap.Error(err))
-		return "", false
+// recordExpiresAt - функция для чтения срока жизни из записи пакета
+func recordExpiresAt(record map[string]string) (*time.Time, error) {
+	value := record["expires_at"]
+	if value == "" {
+		return nil, nil
 	}
-	defer conn.Release()
 
-	query := "INSERT INTO urls (id, url) VALUES ($1, $2)"
-	_, err = conn.Exec(context.Background(), query, id, url)
+	expiresAt, err := time.Parse(time.RFC3339, value)
 	if err != nil {
-		pgErr, ok := err.(*pgconn.PgError)
-		if ok && pgErr.Code == pgerrcode.UniqueViolation {
-			switch pgErr.ConstraintName {
-			case "urls_pkey":
-				// ID уже существует в базе данных, генерируем новый
-				if attempts > 0 {
-					newID := helpers.GenerateID(6)
-					return r.addURLWithRetry(newID, url, userID, attempts-1)
-				} else {
-					r.logger.Warn("Exceeded maximum retry attempts")
-				}
-			case "urls_url_key":
-				// URL уже существует в базе данных, возвращаем соответствующий ID
-				urlInDB, ok := r.GetIDByURL(url)
-				if !ok {
-					r.logger.Error("Failed to get ID by URL", zap.Error(err))
-					return "", false
-				}
-				return urlInDB, false
-			default:
-				r.logger.Error("Failed to add URL", zap.Error(err))
-			}
-		} else {
-			r.logger.Error("Failed to add URL", zap.Error(err))
-		}
-		return "", false
+		return nil, fmt.Errorf("invalid expires_at %q: %w", value, err)
 	}
-
-	// Добавляем данные в таблицу user_urls
-	userQuery := "INSERT INTO user_urls (idshorturl, userid) VALUES ($1, $2)"
-	_, userErr := conn.Exec(context.Background(), userQuery, id, userID)
-	if userErr != nil {
-		r.logger.Error("Failed to add user URL", zap.Error(userErr))
-		conn.Release()
-		return "", false
-	}
-	conn.Release()
-	return id, true
+	return &expiresAt, nil
 }
 
-func (r *PostgresURLRepository) AddURLwithTx(records []map[string]string, ctx context.Context, DBString string, BaseURL string, userID string) ([]map[string]string, bool) {
-
-	conn, err := sql.Open("pgx", DBString)
-	if err != nil {
-		r.logger.Error("Error sql.Open", zap.Error(err))
-		return nil, false
-	}
-
-	tx, err := conn.BeginTx(ctx, nil)
-	if err != nil {
-		r.logger.Error("Error BeginTx", zap.Error(err))
-		return nil, false
-	}
-	defer tx.Rollback()
-
-	res := make([]map[string]string, 0, len(records))
-
-	// Обрабатываем каждую запись
-	for _, record := range records {
-		correlationID := record["correlation_id"]
-		originalURL := record["original_url"]
+// Названия хранилищ, выбираемых конфигурацией
+const (
+	BackendPostgres = "postgres"
+	BackendFile     = "file"
+	BackendMemory   = "memory"
+)
 
-		_, err = tx.Exec("INSERT INTO urls (id, url) VALUES ($1, $2)", correlationID, originalURL)
-		if err != nil {
-			r.logger.Error("Error Exec", zap.Error(err))
-			return nil, false
+// Backend - функция для определения хранилища, которое будет использоваться с конфигурацией cfg
+func Backend(cfg *config.Config) string {
+	switch {
+	case cfg.DataBase != "":
+		return BackendPostgres
+	case cfg.FilePath != "":
+		return BackendFile
+	default:
+		return BackendMemory
+	}
+}
+
+// NewStorage - функция для создания хранилища, выбранного конфигурацией. Для Postgres
+// пул должен быть открыт, для остальных хранилищ он не используется
+func NewStorage(cfg *config.Config, pool *pgxpool.Pool, logger *zap.Logger) (Storage, error) {
+	switch Backend(cfg) {
+	case BackendPostgres:
+		if pool == nil {
+			return nil, errors.New("postgres storage requires a connection pool")
 		}
 
-		_, err = tx.Exec("INSERT INTO user_urls (idshorturl, userid) VALUES ($1, $2)", correlationID, userID)
-		if err != nil {
-			r.logger.Error("Error Exec", zap.Error(err))
-			return nil, false
+		// Приведение схемы БД к актуальной версии
+		if err := migrateUp(context.Background(), pool, logger); err != nil {
+			return nil, fmt.Errorf("apply migrations: %w", err)
 		}
-
-		shortURL := fmt.Sprintf("%s/%s", BaseURL, correlationID)
-
-		// Добавляем результат в ответ
-		res = append(
-			res, map[string]string{
-				"correlation_id": correlationID,
-				"short_url":      shortURL,
-			},
-		)
-	}
-
-	err = tx.Commit()
-	if err != nil {
-		r.logger.Error("Error commit", zap.Error(err))
-		return nil, false
-	}
-	return res, true
-}
-
-func (r *PostgresURLRepository) GetIDByURL(url string) (string, bool) {
-	var id string
-	query := "SELECT id FROM urls WHERE url = $1"
-	err := r.db.QueryRow(context.Background(), query, url).Scan(&id)
-	if err != nil {
-		if err == pgx.ErrNoRows {
-			return "", false
+		store := NewPostgresURLRepository(pool, logger)
+		store.canon = canonOptions(cfg)
+		if err := store.BackfillCanonical(context.Background()); err != nil {
+			return nil, fmt.Errorf("backfill canonical URLs: %w", err)
 		}
-		r.logger.Error("Failed to get ID by URL", zap.Error(err))
-		return "", false
-	}
-	return id, true
-}
+		return Instrument(store, BackendPostgres, logger), nil
 
-func (r *PostgresURLRepository) GetURLByID(id string, DataBase string) (string, bool) {
+	case BackendFile:
+		store := NewFileStore(cfg.FilePath, logger)
+		store.canon = canonOptions(cfg)
 
-	// Использование пула подключений для выполнения запросов
-	conn, err := r.pool.Acquire(context.Background())
-	if err != nil {
-		r.logger.Error("Error open connection", zap.Error(err))
-	}
-	defer conn.Release()
-
-	var url string
-	query := "SELECT url FROM urls WHERE id = $1"
-	err = conn.QueryRow(context.Background(), query, id).Scan(&url)
-	if err != nil {
-		if err == pgx.ErrNoRows {
-			return "", false
+		// Загрузка данных из файла
+		if err := store.LoadFromFile(); err != nil {
+			return nil, fmt.Errorf("load %s: %w", cfg.FilePath, err)
 		}
-		r.logger.Error("Failed to get URL by ID", zap.Error(err))
-		conn.Release()
-		return "", false
-	}
-
-	var delFlag bool
-	query = "SELECT delFLAG FROM user_urls WHERE IDshortURL = $1"
-	err = conn.QueryRow(context.Background(), query, id).Scan(&delFlag)
-	if err != nil {
-		if err == pgx.ErrNoRows {
-			conn.Release()
-			return "", false
+		if cfg.CompactInterval > 0 {
+			go store.RunCompaction(cfg.CompactInterval)
 		}
-		r.logger.Error("Failed to get delFLAG by IDshortURL", zap.Error(err))
-		return "", false
-	}
+		return Instrument(store, BackendFile, logger), nil
 
-	if delFlag {
-		conn.Release()
-		return url, false
+	default:
+		store := NewMemoryStore(logger)
+		store.canon = canonOptions(cfg)
+		return Instrument(store, BackendMemory, logger), nil
 	}
-	conn.Release()
-	return url, true
 }
 
-func (r *PostgresURLRepository) GetURLsByUserID(userID string) []URL {
-	var userURLs []URL
-	query := `
-        SELECT u.URL, uu.IDshortURL
-        FROM urls u
-        JOIN user_urls uu ON u.ID = uu.IDshortURL
-        WHERE uu.userID = $1
-    `
-	rows, err := r.db.Query(context.Background(), query, userID)
-	if err != nil {
-		r.logger.Error("Failed to get URLs by UserID", zap.Error(err))
-		return nil
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var url, shortURL string
-		err := rows.Scan(&url, &shortURL)
-		if err != nil {
-			r.logger.Error("Failed to scan URL and ShortURL", zap.Error(err))
-			return nil
-		}
-		userURLs = append(userURLs, URL{ID: shortURL, URL: url, UserID: userID})
-	}
-
-	if err := rows.Err(); err != nil {
-		r.logger.Error("Error occurred while iterating over rows", zap.Error(err))
-		return nil
-	}
-
-	return userURLs
-}
-
-func (r *PostgresURLRepository) PrintAllURLs() {
-	rows, err := r.db.Query(context.Background(), "SELECT id, url FROM urls")
-	if err != nil {
-		r.logger.Error("Failed to query URLs", zap.Error(err))
-		return
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var id, url string
-		err := rows.Scan(&id, &url)
-		if err != nil {
-			r.logger.Error("Failed to scan row", zap.Error(err))
-			continue
-		}
-		r.logger.Info(
-			"URL",
-			zap.String("ID", id),
-			zap.String("URL", url),
-		)
-	}
-
-	if err := rows.Err(); err != nil {
-		r.logger.Error("Error iterating over rows", zap.Error(err))
-	}
-}
-
-func (r *PostgresURLRepository) CreateTable() error {
-	_, err := r.db.Exec(
-		context.Background(), `
-		CREATE TABLE IF NOT EXISTS urls (
-			ID TEXT PRIMARY KEY,
-			URL TEXT,
-			UNIQUE (URL)
-		)
-	`,
-	)
-	if err != nil {
-		return err
-	}
-
-	_, err = r.db.Exec(
-		context.Background(), `
-		CREATE TABLE IF NOT EXISTS user_urls (
-			ID SERIAL PRIMARY KEY,
-			IDshortURL TEXT,
-			userID TEXT,
-			delFLAG BOOL DEFAULT false
-		)
-	`,
-	)
+// migrateUp применяет миграции на соединении из пула: блокировка миграций
+// держится на уровне сессии, поэтому все шаги должны идти через одно соединение
+func migrateUp(ctx context.Context, pool *pgxpool.Pool, logger *zap.Logger) error {
+	conn, err := pool.Acquire(ctx)
 	if err != nil {
 		return err
 	}
+	defer conn.Release()
 
-	_, err = r.db.Exec(
-		context.Background(), `
-		ALTER TABLE user_urls
-		ADD CONSTRAINT fk_name_IDshortURL
-		FOREIGN KEY (IDshortURL) REFERENCES urls (ID);
-
-	`,
-	)
+	migrator, err := migrations.NewMigrator(conn.Conn(), logger)
 	if err != nil {
 		return err
 	}
+	return migrator.Up(ctx)
+}
 
-	return nil
+// canonOptions - функция для получения настроек приведения ссылок из конфигурации
+func canonOptions(cfg *config.Config) urlcanon.Options {
+	return urlcanon.Options{SortQuery: cfg.CanonicalSortQuery, StripTracking: cfg.CanonicalStripTracking}
 }
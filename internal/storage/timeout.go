@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// Timeouts - предельное время одной операции с хранилищем, 0 - без ограничения
+type Timeouts struct {
+	Read  time.Duration
+	Write time.Duration
+}
+
+type timeoutsKey struct{}
+
+// WithTimeouts - функция для передачи ограничений времени операций через контекст запроса
+func WithTimeouts(ctx context.Context, t Timeouts) context.Context {
+	return context.WithValue(ctx, timeoutsKey{}, t)
+}
+
+// ReadContext - функция для получения контекста операции чтения с ограничением из ctx
+func ReadContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	t, _ := ctx.Value(timeoutsKey{}).(Timeouts)
+	return WithTimeout(ctx, t.Read)
+}
+
+// WriteContext - функция для получения контекста операции записи с ограничением из ctx
+func WriteContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	t, _ := ctx.Value(timeoutsKey{}).(Timeouts)
+	return WithTimeout(ctx, t.Write)
+}
+
+// WithTimeout - функция для ограничения времени операции, при timeout <= 0 ctx возвращается без изменений
+func WithTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
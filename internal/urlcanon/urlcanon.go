@@ -0,0 +1,132 @@
+package urlcanon
+
+import (
+	"net"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Параметры запроса, которые добавляют рекламные и почтовые системы для отслеживания переходов
+var trackingParams = map[string]struct{}{
+	"fbclid":    {},
+	"gclid":     {},
+	"yclid":     {},
+	"dclid":     {},
+	"msclkid":   {},
+	"mc_cid":    {},
+	"mc_eid":    {},
+	"_openstat": {},
+}
+
+// Стандартные порты схем, которые не влияют на адрес ресурса
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// Options - настройки приведения ссылок к каноническому виду
+type Options struct {
+	SortQuery     bool // Сортировать параметры запроса по имени
+	StripTracking bool // Удалять параметры отслеживания utm_* и подобные
+}
+
+// Default возвращает настройки, с которыми приводятся ссылки, если иное не задано в конфигурации
+func Default() Options {
+	return Options{SortQuery: true, StripTracking: true}
+}
+
+// Canonical возвращает канонический вид ссылки для поиска дубликатов: схема и хост в нижнем
+// регистре, без стандартного порта, с нормализованным путем и без пустого запроса.
+// Ссылка, которую не удалось разобрать, возвращается без изменений
+func (o Options) Canonical(raw string) string {
+	raw = strings.TrimSpace(raw)
+	u, err := url.Parse(raw)
+	if err != nil || u.Opaque != "" {
+		return raw
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+
+	host, port := strings.ToLower(u.Hostname()), u.Port()
+	if port == defaultPorts[u.Scheme] {
+		port = ""
+	}
+	switch {
+	case port != "":
+		u.Host = net.JoinHostPort(host, port)
+	case strings.Contains(host, ":"):
+		u.Host = "[" + host + "]"
+	default:
+		u.Host = host
+	}
+
+	if u.RawPath == "" {
+		// Путь с нестандартным кодированием, например %2F, не трогаем: декодирование изменит его смысл
+		u.Path = normalizePath(u.Path)
+	}
+	u.RawQuery = o.query(u.RawQuery)
+	u.ForceQuery = false
+
+	return u.String()
+}
+
+// normalizePath убирает сегменты "." и "..", повторные слеши и заменяет пустой путь на "/"
+func normalizePath(p string) string {
+	if p == "" || p == "/" {
+		return "/"
+	}
+
+	cleaned := path.Clean("/" + p)
+	if strings.HasSuffix(p, "/") && cleaned != "/" {
+		// Завершающий слеш может менять смысл пути, поэтому сохраняется
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// query удаляет пустые и отслеживающие параметры и при необходимости сортирует остальные
+func (o Options) query(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+
+	params := make([]string, 0, strings.Count(rawQuery, "&")+1)
+	for _, param := range strings.Split(rawQuery, "&") {
+		if param == "" {
+			continue
+		}
+		if o.StripTracking && isTracking(param) {
+			continue
+		}
+		params = append(params, param)
+	}
+
+	if o.SortQuery {
+		// Порядок одноименных параметров сохраняется, он может быть значимым
+		sort.SliceStable(
+			params, func(i, j int) bool {
+				return paramName(params[i]) < paramName(params[j])
+			},
+		)
+	}
+	return strings.Join(params, "&")
+}
+
+func paramName(param string) string {
+	name, _, _ := strings.Cut(param, "=")
+	if unescaped, err := url.QueryUnescape(name); err == nil {
+		return unescaped
+	}
+	return name
+}
+
+func isTracking(param string) bool {
+	name := strings.ToLower(paramName(param))
+	if strings.HasPrefix(name, "utm_") {
+		return true
+	}
+	_, ok := trackingParams[name]
+	return ok
+}
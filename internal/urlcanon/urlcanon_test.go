@@ -0,0 +1,28 @@
+package urlcanon
+
+import "testing"
+
+func TestCanonical(t *testing.T) {
+	tests := []struct {
+		opts Options
+		raw  string
+		want string
+	}{
+		{Default(), "HTTP://Example.com/", "http://example.com/"},
+		{Default(), "http://example.com", "http://example.com/"},
+		{Default(), "http://example.com/?", "http://example.com/"},
+		{Default(), "https://example.com:443/a/./b/../c", "https://example.com/a/c"},
+		{Default(), "http://example.com:8080//a//b/", "http://example.com:8080/a/b/"},
+		{Default(), "http://example.com/p?b=2&a=1&utm_source=x&fbclid=y", "http://example.com/p?a=1&b=2"},
+		{Default(), "http://example.com/p?a=2&a=1#Part", "http://example.com/p?a=2&a=1#Part"},
+		{Options{}, "http://example.com/p?b=2&utm_source=x&a=1", "http://example.com/p?b=2&utm_source=x&a=1"},
+		{Options{StripTracking: true}, "http://example.com/p?b=2&utm_source=x&a=1", "http://example.com/p?b=2&a=1"},
+		{Default(), "http://[::1]:80/", "http://[::1]/"},
+		{Default(), "http://example.com/a%2Fb/../c", "http://example.com/a%2Fb/../c"},
+	}
+	for _, tt := range tests {
+		if got := tt.opts.Canonical(tt.raw); got != tt.want {
+			t.Errorf("%+v.Canonical(%q) = %q, want %q", tt.opts, tt.raw, got, tt.want)
+		}
+	}
+}
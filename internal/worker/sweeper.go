@@ -0,0 +1,68 @@
+package worker
+
+import (
+	"context"
+	"github.com/egosha7/shortlink/internal/storage"
+	"go.uber.org/zap"
+	"time"
+)
+
+// Sweeper периодически помечает удаленными ссылки с истекшим сроком жизни
+type Sweeper struct {
+	store    storage.Storage
+	interval time.Duration
+	logger   *zap.Logger
+	done     chan struct{}
+	stopped  chan struct{}
+}
+
+func NewSweeper(store storage.Storage, interval time.Duration, logger *zap.Logger) *Sweeper {
+	s := &Sweeper{
+		store:    store,
+		interval: interval,
+		logger:   logger,
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+
+	// Запуск горутины для периодической очистки
+	go s.run()
+
+	return s
+}
+
+func (s *Sweeper) run() {
+	defer close(s.stopped)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case now := <-ticker.C:
+			s.sweep(now)
+		}
+	}
+}
+
+// sweep выполняет один проход очистки, который не должен длиться дольше периода
+func (s *Sweeper) sweep(now time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.interval)
+	defer cancel()
+
+	n, err := s.store.DeleteExpiredURLs(ctx, now)
+	if err != nil {
+		s.logger.Error("Error deleting expired URLs", zap.Error(err))
+	}
+	if n > 0 {
+		s.logger.Info("Expired URLs deleted", zap.Int("count", n))
+	}
+}
+
+// Stop останавливает периодическую очистку и дожидается завершения текущего прохода
+func (s *Sweeper) Stop() {
+	close(s.done)
+	<-s.stopped
+}
@@ -1,42 +1,187 @@
 package worker
 
-import "github.com/egosha7/shortlink/internal/storage"
+import (
+	"context"
+	"errors"
+	"github.com/egosha7/shortlink/internal/config"
+	"github.com/egosha7/shortlink/internal/loger"
+	"github.com/egosha7/shortlink/internal/storage"
+	"go.uber.org/zap"
+	"sync"
+	"sync/atomic"
+	"time"
+)
 
+// Ошибки постановки запроса на удаление в очередь
+var (
+	ErrStopped   = errors.New("worker is stopped")
+	ErrQueueFull = errors.New("delete queue is full")
+)
+
+// Повторные попытки удаления при временных ошибках хранилища
+const (
+	maxAttempts    = 5
+	initialBackoff = 100 * time.Millisecond
+)
+
+// Worker принимает запросы на удаление в буферизованную очередь и удаляет ссылки
+// пачками: несколько обработчиков объединяют запросы разных пользователей в одну
+// операцию хранилища по достижении размера пачки или по истечении интервала
 type Worker struct {
 	urlsChan chan deleteRequest
-	store    *storage.URLStore
+	store    storage.Storage
+	logger   *zap.Logger
+
+	batchSize     int
+	flushInterval time.Duration
+	timeout       time.Duration // Предельное время одной попытки удаления
+
+	// queued - количество ссылок, принятых в очередь и еще не удаленных
+	queued atomic.Int64
+
+	// mu защищает закрытие канала от одновременной отправки в него
+	mu      sync.RWMutex
+	stopped bool
+	wg      sync.WaitGroup
 }
 
 type deleteRequest struct {
-	urls   []string
-	userID string
+	urls      []string
+	userID    string
+	requestID string // ID HTTP-запроса для связи логов обработчика с логами удаления
 }
 
-func NewWorker(store *storage.URLStore) *Worker {
-	// Инициализация канала
-	urlsChan := make(chan deleteRequest)
-
-	// Запуск горутины для обработки запросов на удаление
-	go processDeleteRequests(urlsChan, store)
+func NewWorker(store storage.Storage, cfg *config.Config, logger *zap.Logger) *Worker {
+	w := &Worker{
+		// Инициализация канала
+		urlsChan:      make(chan deleteRequest, cfg.DeleteQueueSize),
+		store:         store,
+		logger:        logger,
+		batchSize:     cfg.DeleteBatchSize,
+		flushInterval: cfg.DeleteFlushInterval,
+		timeout:       cfg.StorageWriteTimeout,
+	}
 
-	return &Worker{
-		urlsChan: urlsChan,
-		store:    store,
+	// Запуск горутин для обработки запросов на удаление
+	for i := 0; i < cfg.DeleteWorkers; i++ {
+		w.wg.Add(1)
+		go w.processDeleteRequests()
 	}
+
+	return w
 }
 
-func (w *Worker) DeleteURLs(urls []string, userID string) {
+// DeleteURLs ставит запрос в очередь без ожидания, при заполненной очереди возвращает ErrQueueFull
+func (w *Worker) DeleteURLs(ctx context.Context, urls []string, userID string) error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if w.stopped {
+		return ErrStopped
+	}
+
 	// Создаем deleteRequest и отправляем его в канал
 	req := deleteRequest{
-		urls:   urls,
-		userID: userID,
+		urls:      urls,
+		userID:    userID,
+		requestID: loger.RequestID(ctx),
+	}
+	select {
+	case w.urlsChan <- req:
+		w.queued.Add(int64(len(urls)))
+		return nil
+	default:
+		return ErrQueueFull
 	}
-	w.urlsChan <- req
 }
 
-func processDeleteRequests(urlsChan <-chan deleteRequest, store *storage.URLStore) {
-	for req := range urlsChan {
-		// Выполняем операции с ссылками, например, вызываем метод DeleteURLs
-		store.DeleteURLs(req.urls, req.userID)
+// QueueDepth возвращает количество ссылок, ожидающих удаления
+func (w *Worker) QueueDepth() int {
+	return int(w.queued.Load())
+}
+
+// Stop прекращает прием запросов и дожидается выполнения уже принятых
+func (w *Worker) Stop(ctx context.Context) error {
+	w.mu.Lock()
+	if !w.stopped {
+		w.stopped = true
+		close(w.urlsChan)
+	}
+	w.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (w *Worker) processDeleteRequests() {
+	defer w.wg.Done()
+
+	ticker := time.NewTicker(w.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]storage.Deletion, 0, w.batchSize)
+	var requestIDs []string
+	for {
+		select {
+		case req, ok := <-w.urlsChan:
+			if !ok {
+				// Очередь закрыта при остановке, удаляем накопленное и выходим
+				w.flush(batch, requestIDs)
+				return
+			}
+			for _, id := range req.urls {
+				batch = append(batch, storage.Deletion{ID: id, UserID: req.userID})
+			}
+			if req.requestID != "" {
+				requestIDs = append(requestIDs, req.requestID)
+			}
+			if len(batch) >= w.batchSize {
+				w.flush(batch, requestIDs)
+				batch, requestIDs = batch[:0], requestIDs[:0]
+			}
+		case <-ticker.C:
+			w.flush(batch, requestIDs)
+			batch, requestIDs = batch[:0], requestIDs[:0]
+		}
+	}
+}
+
+// flush удаляет пачку ссылок, повторяя попытку с экспоненциальной задержкой при временных ошибках.
+// В логах пачки перечисляются ID запросов, из которых она собрана
+func (w *Worker) flush(batch []storage.Deletion, requestIDs []string) {
+	if len(batch) == 0 {
+		return
+	}
+	defer w.queued.Add(-int64(len(batch)))
+
+	logger := w.logger.With(zap.Strings("request_ids", requestIDs))
+
+	backoff := initialBackoff
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := storage.WithTimeout(context.Background(), w.timeout)
+		err := w.store.DeleteURLsBatch(ctx, batch)
+		cancel()
+		if err == nil {
+			logger.Debug("URLs deleted", zap.Int("count", len(batch)))
+			return
+		}
+		if !storage.IsRetryable(err) || attempt == maxAttempts {
+			logger.Error("Error deleting URLs", zap.Int("count", len(batch)), zap.Int("attempt", attempt), zap.Error(err))
+			return
+		}
+
+		logger.Warn("Retrying URL deletion", zap.Int("attempt", attempt), zap.Duration("backoff", backoff), zap.Error(err))
+		time.Sleep(backoff)
+		backoff *= 2
 	}
 }
@@ -0,0 +1,60 @@
+package worker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/egosha7/shortlink/internal/config"
+	"github.com/egosha7/shortlink/internal/storage"
+	"go.uber.org/zap"
+)
+
+func TestWorkerStopDrains(t *testing.T) {
+	store := storage.NewMemoryStore(zap.NewNop())
+	store.AddURL(context.Background(), "a1", "http://a.example.com", "user1", nil)
+	store.AddURL(context.Background(), "b2", "http://b.example.com", "user2", nil)
+	store.AddURL(context.Background(), "c3", "http://c.example.com", "user2", nil)
+
+	// Пачка не заполняется и интервал не истекает, удаление происходит только при остановке
+	cfg := config.Default()
+	cfg.DeleteBatchSize = 100
+	cfg.DeleteFlushInterval = time.Hour
+
+	wkr := NewWorker(store, cfg, zap.NewNop())
+	if err := wkr.DeleteURLs(context.Background(), []string{"a1"}, "user1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := wkr.DeleteURLs(context.Background(), []string{"b2", "c3"}, "user1"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := wkr.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Принятые до остановки удаления должны быть выполнены
+	if _, err := store.GetURL(context.Background(), "a1"); err == nil {
+		t.Errorf("URL a1 not deleted before stop")
+	}
+	// Чужие ссылки не удаляются, даже попав в одну пачку
+	if _, err := store.GetURL(context.Background(), "b2"); err != nil {
+		t.Errorf("URL b2 deleted by another user")
+	}
+	if depth := wkr.QueueDepth(); depth != 0 {
+		t.Errorf("queue depth after stop: %d", depth)
+	}
+	if err := wkr.DeleteURLs(context.Background(), []string{"a1"}, "user1"); err != ErrStopped {
+		t.Errorf("stopped worker accepted request: %v", err)
+	}
+}
+
+func TestWorkerQueueFull(t *testing.T) {
+	// Без буфера и без готового обработчика запрос не принимается
+	wkr := &Worker{urlsChan: make(chan deleteRequest), logger: zap.NewNop()}
+	if err := wkr.DeleteURLs(context.Background(), []string{"a1"}, "user1"); err != ErrQueueFull {
+		t.Errorf("full queue accepted request: %v", err)
+	}
+}